@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tomcat AccessLogValve pattern aliases.
+var accessLogPatternAliases = map[string]string{
+	"common":   `%h %l %u %t "%r" %s %b`,
+	"combined": `%h %l %u %t "%r" %s %b "%{Referer}i" "%{User-Agent}i"`,
+}
+
+// Label values come from request URLs anyone can send, so only successful
+// requests keep their layer, gridset, zoom and format, only up to these many
+// distinct values and only zoom levels up to accessLogMaxZoom; everything
+// else is counted as "other".
+const (
+	accessLogMaxLayers   = 1000
+	accessLogMaxGridsets = 100
+	accessLogMaxFormats  = 50
+	accessLogMaxZoom     = 30
+)
+
+// labelCap admits label values until limit distinct values were seen.
+type labelCap struct {
+	limit int
+	seen  map[string]bool
+}
+
+func newLabelCap(limit int) *labelCap {
+	return &labelCap{limit: limit, seen: map[string]bool{}}
+}
+
+func (c *labelCap) value(v string) string {
+	if v == "" || c.seen[v] {
+		return v
+	}
+	if len(c.seen) >= c.limit {
+		return "other"
+	}
+	c.seen[v] = true
+	return v
+}
+
+// accessLogCollector tails Tomcat access logs and turns GWC tile requests into
+// per-layer request, byte, status and latency metrics. It complements the
+// global counters from the home page when no reverse proxy logs are available.
+type accessLogCollector struct {
+	pattern        *accessLogPattern
+	durationFactor float64 // %D unit -> seconds
+
+	// Only used from the follower goroutine.
+	layers   *labelCap
+	gridsets *labelCap
+	formats  *labelCap
+
+	requests_total   *prometheus.CounterVec   // labels: layer, gridset, zoom, format, status, cache_result
+	bytes_total      *prometheus.CounterVec   // labels: layer, format
+	request_duration *prometheus.HistogramVec // label: layer
+	lines_total      *prometheus.CounterVec   // label: result
+}
+
+func newAccessLogCollector(pattern, durationUnit string) (*accessLogCollector, error) {
+	p, err := compileAccessLogPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var factor float64
+	switch durationUnit {
+	case "ms":
+		factor = 1e-3
+	case "us":
+		factor = 1e-6
+	default:
+		return nil, fmt.Errorf("unknown %%D duration unit %q (want ms or us)", durationUnit)
+	}
+
+	const ns = "gwc"
+	return &accessLogCollector{
+		pattern:        p,
+		durationFactor: factor,
+		layers:         newLabelCap(accessLogMaxLayers),
+		gridsets:       newLabelCap(accessLogMaxGridsets),
+		formats:        newLabelCap(accessLogMaxFormats),
+
+		requests_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_access_requests_total",
+			Help: "Tile requests seen in the access log.",
+		}, []string{"layer", "gridset", "zoom", "format", "status", "cache_result"}),
+		bytes_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_access_bytes_total",
+			Help: "Response bytes of tile requests seen in the access log.",
+		}, []string{"layer", "format"}),
+		request_duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    ns + "_access_request_duration_seconds",
+			Help:    "Tile request processing time from the access log.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"layer"}),
+		lines_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_access_log_lines_total",
+			Help: "Access log lines read, by result (tile, other, unparsed).",
+		}, []string{"result"}),
+	}, nil
+}
+
+func (c *accessLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests_total.Describe(ch)
+	c.bytes_total.Describe(ch)
+	c.request_duration.Describe(ch)
+	c.lines_total.Describe(ch)
+}
+
+func (c *accessLogCollector) Collect(ch chan<- prometheus.Metric) {
+	c.requests_total.Collect(ch)
+	c.bytes_total.Collect(ch)
+	c.request_duration.Collect(ch)
+	c.lines_total.Collect(ch)
+}
+
+// run follows the access log(s) matching pathPattern until ctx is done.
+func (c *accessLogCollector) run(ctx context.Context, pathPattern string) {
+	newFileFollower(pathPattern, time.Second, c.handleLine).run(ctx)
+}
+
+func (c *accessLogCollector) handleLine(line string) {
+	e, ok := c.pattern.parse(line)
+	if !ok {
+		c.lines_total.WithLabelValues("unparsed").Inc()
+		return
+	}
+	t, ok := parseTileURL(e.uri)
+	if !ok {
+		c.lines_total.WithLabelValues("other").Inc()
+		return
+	}
+	c.lines_total.WithLabelValues("tile").Inc()
+
+	if accessLogSuccess(e.status) {
+		t.layer, t.gridset, t.format = c.layers.value(t.layer), c.gridsets.value(t.gridset), c.formats.value(t.format)
+		t.zoom = zoomFromTileMatrix(t.zoom)
+	} else {
+		t.layer, t.gridset, t.zoom, t.format = "other", "other", "other", "other"
+	}
+	if len(e.status) != 3 {
+		e.status = "other"
+	}
+
+	c.requests_total.WithLabelValues(t.layer, t.gridset, t.zoom, t.format, e.status, e.cacheResult).Inc()
+	if e.bytes > 0 {
+		c.bytes_total.WithLabelValues(t.layer, t.format).Add(float64(e.bytes))
+	}
+	switch {
+	case e.durationD >= 0:
+		c.request_duration.WithLabelValues(t.layer).Observe(e.durationD * c.durationFactor)
+	case e.durationT >= 0:
+		c.request_duration.WithLabelValues(t.layer).Observe(e.durationT)
+	}
+}
+
+// accessLogSuccess reports whether a status means GWC knew the layer: 2xx or
+// 304 Not Modified.
+func accessLogSuccess(status string) bool {
+	return (len(status) == 3 && status[0] == '2') || status == "304"
+}
+
+// accessLogPattern is a compiled AccessLogValve pattern.
+type accessLogPattern struct {
+	re     *regexp.Regexp
+	fields []string // directive per capture group, e.g. "r", "s", "o:geowebcache-cache-result"
+}
+
+type accessLogEntry struct {
+	uri         string
+	status      string
+	bytes       int64
+	durationD   float64 // raw %D value, -1 if absent
+	durationT   float64 // %T seconds, -1 if absent
+	cacheResult string
+}
+
+func compileAccessLogPattern(pattern string) (*accessLogPattern, error) {
+	if alias, ok := accessLogPatternAliases[pattern]; ok {
+		pattern = alias
+	}
+	var (
+		sb     strings.Builder
+		fields []string
+	)
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 >= len(pattern) {
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		i++
+		name := ""
+		if pattern[i] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 || i+end+1 >= len(pattern) {
+				return nil, fmt.Errorf("unterminated %%{...} in access log pattern %q", pattern)
+			}
+			name = strings.ToLower(pattern[i+1 : i+end])
+			i += end + 1
+		}
+		d := pattern[i]
+		switch {
+		case d == '%':
+			sb.WriteString("%")
+			continue
+		case d == 't' && name == "":
+			sb.WriteString(`(\[[^\]]*\])`)
+		case d == 'r' || (name != "" && (d == 'i' || d == 'o' || d == 'c')):
+			// Free text, usually quoted: stop at the next literal.
+			sb.WriteString(`(.*?)`)
+		default:
+			sb.WriteString(`(\S*)`)
+		}
+		if name != "" {
+			fields = append(fields, string(d)+":"+name)
+		} else {
+			fields = append(fields, string(d))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("compile access log pattern %q: %w", pattern, err)
+	}
+	return &accessLogPattern{re: re, fields: fields}, nil
+}
+
+func (p *accessLogPattern) parse(line string) (accessLogEntry, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return accessLogEntry{}, false
+	}
+	e := accessLogEntry{durationD: -1, durationT: -1}
+	var urlPath, query string
+	for i, f := range p.fields {
+		v := m[i+1]
+		switch f {
+		case "r":
+			// "GET /geowebcache/service/wmts?... HTTP/1.1"
+			if parts := strings.Fields(v); len(parts) >= 2 {
+				e.uri = parts[1]
+			}
+		case "U":
+			urlPath = v
+		case "q":
+			query = v
+		case "s":
+			e.status = v
+		case "b", "B":
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				e.bytes = n
+			}
+		case "D":
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				e.durationD = n
+			}
+		case "T":
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				e.durationT = n
+			}
+		case "o:geowebcache-cache-result":
+			if v != "-" {
+				e.cacheResult = v
+			}
+		}
+	}
+	if e.uri == "" && urlPath != "" {
+		e.uri = urlPath + query
+	}
+	return e, e.uri != ""
+}
+
+type tileRequest struct {
+	layer   string
+	gridset string
+	zoom    string
+	format  string
+}
+
+// parseTileURL extracts layer/gridset/zoom/format from the GWC tile services
+// (WMTS KVP and REST, TMS, WMS-C, Google Maps, Virtual Earth, KML). Zoom and
+// gridset stay empty when the protocol does not carry them.
+func parseTileURL(raw string) (tileRequest, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return tileRequest{}, false
+	}
+	q := lowerKeys(u.Query())
+	p := u.Path
+
+	switch {
+	case strings.Contains(p, "/rest/wmts/"):
+		rest := p[strings.Index(p, "/rest/wmts/")+len("/rest/wmts/"):]
+		parts := strings.Split(strings.Trim(rest, "/"), "/")
+		var layer, tms, tm, last string
+		switch len(parts) {
+		case 6: // layer/style/tms/tm/row/col
+			layer, tms, tm, last = parts[0], parts[2], parts[3], parts[5]
+		case 5: // layer/tms/tm/row/col
+			layer, tms, tm, last = parts[0], parts[1], parts[2], parts[4]
+		default:
+			return tileRequest{}, false
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = strings.TrimPrefix(path.Ext(last), ".")
+		}
+		return tileRequest{layer: layer, gridset: tms, zoom: zoomFromTileMatrix(tm), format: format}, true
+
+	case strings.HasSuffix(p, "/service/wmts"):
+		if !strings.EqualFold(q.Get("request"), "gettile") || q.Get("layer") == "" {
+			return tileRequest{}, false
+		}
+		return tileRequest{
+			layer:   q.Get("layer"),
+			gridset: q.Get("tilematrixset"),
+			zoom:    zoomFromTileMatrix(q.Get("tilematrix")),
+			format:  q.Get("format"),
+		}, true
+
+	case strings.Contains(p, "/service/tms/1.0.0/"):
+		rest := p[strings.Index(p, "/service/tms/1.0.0/")+len("/service/tms/1.0.0/"):]
+		parts := strings.Split(strings.Trim(rest, "/"), "/")
+		if len(parts) != 4 {
+			return tileRequest{}, false // capabilities, not a tile
+		}
+		spec := strings.Split(parts[0], "@") // layer@gridset@ext
+		t := tileRequest{layer: spec[0], zoom: parts[1], format: strings.TrimPrefix(path.Ext(parts[3]), ".")}
+		if len(spec) > 1 {
+			t.gridset = spec[1]
+		}
+		if len(spec) > 2 {
+			t.format = spec[2]
+		}
+		return t, true
+
+	case strings.HasSuffix(p, "/service/wms"):
+		if !strings.EqualFold(q.Get("request"), "getmap") || q.Get("layers") == "" {
+			return tileRequest{}, false
+		}
+		gridset := q.Get("srs")
+		if gridset == "" {
+			gridset = q.Get("crs")
+		}
+		return tileRequest{layer: q.Get("layers"), gridset: gridset, format: q.Get("format")}, true
+
+	case strings.HasSuffix(p, "/service/gmaps") || strings.HasSuffix(p, "/service/mgmaps"):
+		if q.Get("layers") == "" {
+			return tileRequest{}, false
+		}
+		return tileRequest{layer: q.Get("layers"), gridset: "GoogleMapsCompatible", zoom: q.Get("zoom"), format: q.Get("format")}, true
+
+	case strings.HasSuffix(p, "/service/ve"):
+		if q.Get("layers") == "" {
+			return tileRequest{}, false
+		}
+		t := tileRequest{layer: q.Get("layers"), gridset: "GoogleMapsCompatible", format: q.Get("format")}
+		if qk := q.Get("quadkey"); qk != "" {
+			t.zoom = strconv.Itoa(len(qk))
+		}
+		return t, true
+
+	case strings.Contains(p, "/service/kml/"):
+		rest := p[strings.Index(p, "/service/kml/")+len("/service/kml/"):]
+		first := strings.SplitN(rest, "/", 2)[0]
+		layer := strings.TrimSuffix(first, path.Ext(first))
+		if layer == "" {
+			return tileRequest{}, false
+		}
+		return tileRequest{layer: layer, gridset: "EPSG:4326", format: strings.TrimPrefix(path.Ext(p), ".")}, true
+	}
+	return tileRequest{}, false
+}
+
+// zoomFromTileMatrix maps "EPSG:4326:5", "5" or "05" to "5". The value comes
+// from the client, so anything but a zoom level from 0 to accessLogMaxZoom
+// becomes "other"; an empty tile matrix stays empty.
+func zoomFromTileMatrix(tm string) string {
+	if tm == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(tm, ':'); i >= 0 {
+		tm = tm[i+1:]
+	}
+	z, err := strconv.Atoi(tm)
+	if err != nil || z < 0 || z > accessLogMaxZoom {
+		return "other"
+	}
+	return strconv.Itoa(z)
+}
+
+func lowerKeys(v url.Values) url.Values {
+	out := make(url.Values, len(v))
+	for k, vals := range v {
+		out[strings.ToLower(k)] = vals
+	}
+	return out
+}
+
+// startAccessLogCollector registers the collector and starts tailing in the background.
+func startAccessLogCollector(ctx context.Context, reg prometheus.Registerer, pathPattern, pattern, durationUnit string) error {
+	c, err := newAccessLogCollector(pattern, durationUnit)
+	if err != nil {
+		return err
+	}
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	go c.run(ctx, pathPattern)
+	log.Printf("access log collector enabled path=%q pattern=%q", pathPattern, pattern)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAccessLogPatternParse(t *testing.T) {
+	tests := []struct {
+		pattern, line string
+		want          accessLogEntry
+		ok            bool
+	}{
+		{
+			pattern: "common",
+			line:    `10.0.0.1 - - [06/Oct/2026:08:00:00 +0000] "GET /geowebcache/service/tms/1.0.0/roads@EPSG:3857@png/5/10/12.png HTTP/1.1" 200 1234`,
+			want:    accessLogEntry{uri: "/geowebcache/service/tms/1.0.0/roads@EPSG:3857@png/5/10/12.png", status: "200", bytes: 1234, durationD: -1, durationT: -1},
+			ok:      true,
+		},
+		{
+			pattern: `%h %t "%r" %s %b %D %{geowebcache-cache-result}o`,
+			line:    `10.0.0.1 [06/Oct/2026:08:00:00 +0000] "GET /geowebcache/service/wmts?REQUEST=GetTile HTTP/1.1" 304 - 15 HIT`,
+			want:    accessLogEntry{uri: "/geowebcache/service/wmts?REQUEST=GetTile", status: "304", durationD: 15, durationT: -1, cacheResult: "HIT"},
+			ok:      true,
+		},
+		{
+			pattern: `%h %U%q %s %b %T %{geowebcache-cache-result}o`,
+			line:    `10.0.0.1 /geowebcache/service/gmaps?layers=roads&zoom=3 200 99 0.012 -`,
+			want:    accessLogEntry{uri: "/geowebcache/service/gmaps?layers=roads&zoom=3", status: "200", bytes: 99, durationD: -1, durationT: 0.012},
+			ok:      true,
+		},
+		{pattern: "common", line: "garbage"},
+		{pattern: "common", line: `10.0.0.1 - - [06/Oct/2026:08:00:00 +0000] "-" 400 0`},
+	}
+	for _, tt := range tests {
+		p, err := compileAccessLogPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tt.pattern, err)
+		}
+		got, ok := p.parse(tt.line)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parse(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+	if _, err := compileAccessLogPattern("%{Referer"); err == nil {
+		t.Error("unterminated %{ accepted")
+	}
+}
+
+func TestParseTileURL(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want tileRequest
+		ok   bool
+	}{
+		{"/geowebcache/rest/wmts/roads/default/EPSG:3857/EPSG:3857:5/10/12?format=image/png", tileRequest{"roads", "EPSG:3857", "5", "image/png"}, true},
+		{"/geowebcache/rest/wmts/roads/EPSG:4326/EPSG:4326:2/1/1.jpeg", tileRequest{"roads", "EPSG:4326", "2", "jpeg"}, true},
+		{"/geowebcache/rest/wmts/roads/WMTSCapabilities.xml", tileRequest{}, false},
+		{"/geowebcache/service/wmts?SERVICE=WMTS&REQUEST=GetTile&LAYER=roads&TILEMATRIXSET=EPSG:900913&TILEMATRIX=EPSG:900913:7&FORMAT=image/png", tileRequest{"roads", "EPSG:900913", "7", "image/png"}, true},
+		{"/geowebcache/service/wmts?REQUEST=GetCapabilities", tileRequest{}, false},
+		{"/geowebcache/service/wmts?REQUEST=GetTile&LAYER=roads&TILEMATRIX=x", tileRequest{"roads", "", "other", ""}, true},
+		{"/geowebcache/service/tms/1.0.0/roads@EPSG:3857@png/5/10/12.png", tileRequest{"roads", "EPSG:3857", "5", "png"}, true},
+		{"/geowebcache/service/tms/1.0.0/roads/5/10/12.jpeg", tileRequest{"roads", "", "5", "jpeg"}, true},
+		{"/geowebcache/service/tms/1.0.0/roads@EPSG:3857@png", tileRequest{}, false},
+		{"/geowebcache/service/wms?REQUEST=GetMap&LAYERS=roads&SRS=EPSG:4326&FORMAT=image/png", tileRequest{"roads", "EPSG:4326", "", "image/png"}, true},
+		{"/geowebcache/service/wms?REQUEST=GetMap&LAYERS=roads&CRS=EPSG:3857", tileRequest{"roads", "EPSG:3857", "", ""}, true},
+		{"/geowebcache/service/wms?REQUEST=GetCapabilities", tileRequest{}, false},
+		{"/geowebcache/service/gmaps?layers=roads&zoom=3&x=1&y=2&format=image/png", tileRequest{"roads", "GoogleMapsCompatible", "3", "image/png"}, true},
+		{"/geowebcache/service/ve?layers=roads&quadkey=0231", tileRequest{"roads", "GoogleMapsCompatible", "4", ""}, true},
+		{"/geowebcache/service/kml/roads.png.kml", tileRequest{"roads.png", "EPSG:4326", "", "kml"}, true},
+		{"/geowebcache/home", tileRequest{}, false},
+		{"%zz", tileRequest{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTileURL(tt.uri)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseTileURL(%q) = %+v, %v; want %+v, %v", tt.uri, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestZoomFromTileMatrix(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"5", "5"},
+		{"05", "5"},
+		{"EPSG:4326:12", "12"},
+		{"0", "0"},
+		{"30", "30"},
+		{"31", "other"},
+		{"-1", "other"},
+		{"99999999999999999999", "other"},
+		{"EPSG:4326:", "other"},
+		{"level5", "other"},
+		{"other", "other"},
+	}
+	for _, tt := range tests {
+		if got := zoomFromTileMatrix(tt.in); got != tt.want {
+			t.Errorf("zoomFromTileMatrix(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Client-controlled values must not create unbounded series.
+func TestAccessLogHandleLineCardinality(t *testing.T) {
+	c, err := newAccessLogCollector(`%r %s`, "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := func(uri, status string) string { return "GET " + uri + " HTTP/1.1 " + status }
+
+	c.handleLine(line("/geowebcache/service/gmaps?layers=roads&zoom=3", "200"))
+	for i := range 50 {
+		c.handleLine(line("/geowebcache/service/gmaps?layers=roads&zoom="+strconv.Itoa(1000+i), "200"))
+		c.handleLine(line("/geowebcache/service/tms/1.0.0/scan"+strconv.Itoa(i)+"/"+strconv.Itoa(i)+"/0/0.png", "404"))
+	}
+	c.handleLine(line("/geowebcache/home", "200"))
+	c.handleLine("garbage")
+
+	if n := testutil.CollectAndCount(c.requests_total); n != 3 {
+		t.Errorf("requests_total has %d series, want 3", n)
+	}
+	for _, tt := range []struct {
+		labels []string
+		want   float64
+	}{
+		{[]string{"roads", "GoogleMapsCompatible", "3", "", "200", ""}, 1},
+		{[]string{"roads", "GoogleMapsCompatible", "other", "", "200", ""}, 50},
+		{[]string{"other", "other", "other", "other", "404", ""}, 50},
+	} {
+		if got := testutil.ToFloat64(c.requests_total.WithLabelValues(tt.labels...)); got != tt.want {
+			t.Errorf("requests_total%v = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+	for result, want := range map[string]float64{"tile": 101, "other": 1, "unparsed": 1} {
+		if got := testutil.ToFloat64(c.lines_total.WithLabelValues(result)); got != want {
+			t.Errorf("lines_total{result=%q} = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestLabelCap(t *testing.T) {
+	c := newLabelCap(2)
+	for _, tt := range []struct{ in, want string }{
+		{"a", "a"}, {"b", "b"}, {"c", "other"}, {"a", "a"}, {"", ""},
+	} {
+		if got := c.value(tt.in); got != tt.want {
+			t.Errorf("value(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
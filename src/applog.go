@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classifiers used when none are configured.
+var defaultAppLogClassifiers = []string{
+	`backend_timeout=(?i)(SocketTimeoutException|Read timed out|connect timed out|ConnectTimeoutException)`,
+	`disk_full=(?i)No space left on device`,
+	`storage_error=StorageException`,
+	`seed_failure=(?i)(seed|truncate|GWCTask).*(failed|aborted)`,
+	`out_of_memory=OutOfMemoryError`,
+}
+
+var appLogLevels = map[string]bool{
+	"TRACE": true, "DEBUG": true, "INFO": true, "WARN": true,
+	"WARNING": true, "ERROR": true, "FATAL": true, "SEVERE": true,
+}
+
+// appLogMaxLoggers bounds the logger label; further loggers count as "other".
+const appLogMaxLoggers = 200
+
+// The logger after the level is a dotted class name or a name in brackets
+// (e.g. [geowebcache.seed]); other words are message text.
+var (
+	appLogDottedLogger    = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)+$`)
+	appLogBracketedLogger = regexp.MustCompile(`^\[([\w$.\-]+)\]$`)
+)
+
+type appLogClassifier struct {
+	class string
+	re    *regexp.Regexp
+}
+
+// appLogCollector follows geowebcache.log and counts log4j/log4j2 messages by
+// level and logger. Continuation lines (stack traces) belong to the message
+// above them, so a classifier matches at most once per message.
+type appLogCollector struct {
+	classifiers []appLogClassifier
+	matched     []bool    // per classifier, for the current message
+	loggers     *labelCap // only used from the follower goroutine
+
+	messages_total *prometheus.CounterVec // labels: level, logger
+	events_total   *prometheus.CounterVec // label: class
+}
+
+func newAppLogCollector(classifiers []string) (*appLogCollector, error) {
+	if len(classifiers) == 0 {
+		classifiers = defaultAppLogClassifiers
+	}
+	c := &appLogCollector{loggers: newLabelCap(appLogMaxLoggers)}
+	for _, spec := range classifiers {
+		class, expr, ok := strings.Cut(spec, "=")
+		if !ok || class == "" || expr == "" {
+			return nil, fmt.Errorf("invalid classifier %q, want class=regex", spec)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("classifier %q: %w", class, err)
+		}
+		c.classifiers = append(c.classifiers, appLogClassifier{class: class, re: re})
+	}
+	c.matched = make([]bool, len(c.classifiers))
+
+	const ns = "gwc"
+	c.messages_total = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: ns + "_log_messages_total",
+		Help: "Messages in the GeoWebCache application log by level and logger.",
+	}, []string{"level", "logger"})
+	c.events_total = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: ns + "_log_events_total",
+		Help: "Application log messages matched by a configured classifier.",
+	}, []string{"class"})
+
+	// Export known classes with 0 so alerts can use increase() right away.
+	for _, cl := range c.classifiers {
+		c.events_total.WithLabelValues(cl.class)
+	}
+	return c, nil
+}
+
+func (c *appLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.messages_total.Describe(ch)
+	c.events_total.Describe(ch)
+}
+
+func (c *appLogCollector) Collect(ch chan<- prometheus.Metric) {
+	c.messages_total.Collect(ch)
+	c.events_total.Collect(ch)
+}
+
+func (c *appLogCollector) run(ctx context.Context, pathPattern string) {
+	newFileFollower(pathPattern, time.Second, c.handleLine).run(ctx)
+}
+
+func (c *appLogCollector) handleLine(line string) {
+	if level, logger, ok := parseLog4jHeader(line); ok {
+		c.messages_total.WithLabelValues(level, c.loggers.value(logger)).Inc()
+		for i := range c.matched {
+			c.matched[i] = false
+		}
+	}
+	for i, cl := range c.classifiers {
+		if !c.matched[i] && cl.re.MatchString(line) {
+			c.matched[i] = true
+			c.events_total.WithLabelValues(cl.class).Inc()
+		}
+	}
+}
+
+// parseLog4jHeader recognizes the first line of a log4j/log4j2 message, e.g.
+//
+//	18 Oct 10:00:00 ERROR [geowebcache.seed] - ...
+//	2026-10-18 10:00:00,123 WARN [org.geowebcache.storage.BlobStore] - ...
+//	2026-10-18 10:00:00,123 [http-nio-8080-exec-1] ERROR org.geowebcache.GeoWebCacheDispatcher - ...
+//
+// Lines not starting with a timestamp or level (stack traces) are continuations.
+// The logger is empty when the word after the level does not look like one,
+// e.g. for layouts without a logger, so message text never becomes a label.
+func parseLog4jHeader(line string) (string, string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !(line[0] >= '0' && line[0] <= '9' || appLogLevels[fields[0]]) {
+		return "", "", false
+	}
+	for i := 0; i < len(fields) && i < 6; i++ {
+		level := strings.Trim(fields[i], "[]")
+		if !appLogLevels[level] {
+			continue
+		}
+		logger := ""
+		if i+1 < len(fields) {
+			word := strings.TrimSuffix(fields[i+1], ":")
+			if m := appLogBracketedLogger.FindStringSubmatch(word); m != nil {
+				logger = m[1]
+			} else if appLogDottedLogger.MatchString(word) {
+				logger = word
+			}
+		}
+		return level, logger, true
+	}
+	return "", "", false
+}
+
+func startAppLogCollector(ctx context.Context, reg prometheus.Registerer, pathPattern string, classifiers []string) error {
+	c, err := newAppLogCollector(classifiers)
+	if err != nil {
+		return err
+	}
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	go c.run(ctx, pathPattern)
+	log.Printf("application log collector enabled path=%q classifiers=%d", pathPattern, len(c.classifiers))
+	return nil
+}
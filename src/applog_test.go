@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseLog4jHeader(t *testing.T) {
+	tests := []struct {
+		line, level, logger string
+		ok                  bool
+	}{
+		{"18 Oct 10:00:00 ERROR [geowebcache.seed] - seeding failed", "ERROR", "geowebcache.seed", true},
+		{"2026-10-18 10:00:00,123 WARN [org.geowebcache.storage.BlobStore] - slow", "WARN", "org.geowebcache.storage.BlobStore", true},
+		{"2026-10-18 10:00:00,123 [http-nio-8080-exec-1] ERROR org.geowebcache.GeoWebCacheDispatcher - boom", "ERROR", "org.geowebcache.GeoWebCacheDispatcher", true},
+		{"2026-10-18 10:00:00,123 INFO org.geowebcache.seed.SeedTask: done", "INFO", "org.geowebcache.seed.SeedTask", true},
+		{"2026-10-18 10:00:00,123 INFO [seeder] - started", "INFO", "seeder", true},
+		{"2026-10-18 10:00:00 ERROR Failed to seed layer foo", "ERROR", "", true},
+		{"2026-10-18 10:00:00 ERROR - no logger", "ERROR", "", true},
+		{"2026-10-18 10:00:00 ERROR", "ERROR", "", true},
+		{"2026-10-18 10:00:00 ERROR [a b] - spaces", "ERROR", "", true},
+		{"2026-10-18 10:00:00 ERROR 1.2.3 - version", "ERROR", "", true},
+		{"WARNING [main] org.apache.catalina.startup.Catalina.start", "WARNING", "main", true},
+		{"\tat org.geowebcache.GeoWebCacheDispatcher.handle(GeoWebCacheDispatcher.java:300)", "", "", false},
+		{"java.lang.OutOfMemoryError: Java heap space", "", "", false},
+		{"2026-10-18 10:00:00 just text", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		level, logger, ok := parseLog4jHeader(tt.line)
+		if level != tt.level || logger != tt.logger || ok != tt.ok {
+			t.Errorf("parseLog4jHeader(%q) = %q, %q, %v; want %q, %q, %v", tt.line, level, logger, ok, tt.level, tt.logger, tt.ok)
+		}
+	}
+}
+
+func TestAppLogCollector(t *testing.T) {
+	c, err := newAppLogCollector(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handleLine("2026-10-18 10:00:00 ERROR [org.geowebcache.seed.SeedTask] - Seed failed for layer roads")
+	c.handleLine("java.net.SocketTimeoutException: Read timed out")
+	c.handleLine("\tat java.net.SocketInputStream.read(SocketInputStream.java:1)")
+	c.handleLine("Caused by: java.net.SocketTimeoutException: Read timed out")
+	for i := range appLogMaxLoggers + 10 {
+		c.handleLine("2026-10-18 10:00:00 INFO [logger" + strconv.Itoa(i) + "] - x")
+		c.handleLine("2026-10-18 10:00:00 ERROR Word" + strconv.Itoa(i) + " is the first word")
+	}
+
+	for _, tt := range []struct {
+		class string
+		want  float64
+	}{{"seed_failure", 1}, {"backend_timeout", 1}, {"disk_full", 0}} {
+		if got := testutil.ToFloat64(c.events_total.WithLabelValues(tt.class)); got != tt.want {
+			t.Errorf("events_total{class=%q} = %v, want %v", tt.class, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(c.messages_total.WithLabelValues("ERROR", "")); got != appLogMaxLoggers+10 {
+		t.Errorf("messages without logger = %v", got)
+	}
+	if got := testutil.ToFloat64(c.messages_total.WithLabelValues("INFO", "other")); got != 11 {
+		t.Errorf("messages over the logger cap = %v, want 11", got)
+	}
+	if n := testutil.CollectAndCount(c.messages_total); n != appLogMaxLoggers+2 {
+		t.Errorf("messages_total has %d series, want %d", n, appLogMaxLoggers+2)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// arcgisConf is the part of an ArcGIS cache conf.xml the scanner needs.
+type arcgisConf struct {
+	StorageFormat   string `xml:"CacheStorageInfo>StorageFormat"`
+	PacketSize      int    `xml:"CacheStorageInfo>PacketSize"`
+	CacheTileFormat string `xml:"TileImageInfo>CacheTileFormat"`
+	WKID            string `xml:"TileCacheInfo>SpatialReference>WKID"`
+	LODs            []struct {
+		LevelID int `xml:"LevelID"`
+	} `xml:"TileCacheInfo>LODInfos>LODInfo"`
+}
+
+// arcgisExtent is the envelope of conf.cdi.
+type arcgisExtent struct {
+	XMin, YMin, XMax, YMax float64
+}
+
+type arcgisLayerSource struct {
+	name string
+	conf string // path of conf.xml
+	root string // directory holding _alllayers (defaults to the conf.xml directory)
+}
+
+type arcgisLevelStats struct {
+	tiles   float64
+	bytes   float64
+	bundles float64
+}
+
+type arcgisLayerStats struct {
+	name    string
+	ok      bool
+	conf    arcgisConf
+	extent  *arcgisExtent
+	storage string // exploded, compact, compactv2
+	levels  map[string]*arcgisLevelStats
+}
+
+// arcgisCollector scans ArcGIS exploded and compact caches served through GWC
+// arcgisLayer definitions. Compact bundles are read through their index
+// (.bundlx for V1, the bundle header for V2) instead of walking tiles.
+type arcgisCollector struct {
+	paths    []string // layer directories with conf.xml; "config" = arcgisLayers of geowebcache.xml
+	config   func() *gwcConfig
+	interval time.Duration
+
+	mu       sync.Mutex
+	layers   []arcgisLayerStats
+	lastScan time.Time
+	duration time.Duration
+
+	layer_up       *prometheus.Desc // label: layer
+	layer_info     *prometheus.Desc // labels: layer, storage, format, wkid
+	levels         *prometheus.Desc // label: layer
+	extent         *prometheus.Desc // labels: layer, bound
+	tiles          *prometheus.Desc // labels: layer, level
+	bytes          *prometheus.Desc // labels: layer, level
+	bundles        *prometheus.Desc // labels: layer, level
+	scan_duration  *prometheus.Desc
+	scan_timestamp *prometheus.Desc
+}
+
+func newArcgisCollector(paths []string, config func() *gwcConfig, interval time.Duration) *arcgisCollector {
+	const ns = "gwc_arcgis"
+	return &arcgisCollector{
+		paths:    paths,
+		config:   config,
+		interval: interval,
+
+		layer_up:       prometheus.NewDesc(ns+"_layer_up", "1 if the ArcGIS cache of the layer could be read in the last scan, else 0.", []string{"layer"}, nil),
+		layer_info:     prometheus.NewDesc(ns+"_layer_info", "ArcGIS cache storage and tile format from conf.xml; value 1.", []string{"layer", "storage", "format", "wkid"}, nil),
+		levels:         prometheus.NewDesc(ns+"_levels", "Levels of detail defined in conf.xml.", []string{"layer"}, nil),
+		extent:         prometheus.NewDesc(ns+"_extent", "Cache extent from conf.cdi.", []string{"layer", "bound"}, nil),
+		tiles:          prometheus.NewDesc(ns+"_tiles", "Tiles stored per level.", []string{"layer", "level"}, nil),
+		bytes:          prometheus.NewDesc(ns+"_bytes", "Tile bytes stored per level.", []string{"layer", "level"}, nil),
+		bundles:        prometheus.NewDesc(ns+"_bundles", "Compact cache bundle files per level.", []string{"layer", "level"}, nil),
+		scan_duration:  prometheus.NewDesc(ns+"_scan_duration_seconds", "Duration of the last ArcGIS cache scan.", nil, nil),
+		scan_timestamp: prometheus.NewDesc(ns+"_last_scan_timestamp_seconds", "Unix time the last ArcGIS cache scan finished.", nil, nil),
+	}
+}
+
+func (c *arcgisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.layer_up
+	ch <- c.layer_info
+	ch <- c.levels
+	ch <- c.extent
+	ch <- c.tiles
+	ch <- c.bytes
+	ch <- c.bundles
+	ch <- c.scan_duration
+	ch <- c.scan_timestamp
+}
+
+func (c *arcgisCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastScan.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.scan_duration, prometheus.GaugeValue, c.duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.scan_timestamp, prometheus.GaugeValue, float64(c.lastScan.Unix()))
+	for _, l := range c.layers {
+		up := 0.0
+		if l.ok {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.layer_up, prometheus.GaugeValue, up, l.name)
+		if !l.ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.layer_info, prometheus.GaugeValue, 1, l.name, l.storage, l.conf.CacheTileFormat, l.conf.WKID)
+		ch <- prometheus.MustNewConstMetric(c.levels, prometheus.GaugeValue, float64(len(l.conf.LODs)), l.name)
+		if e := l.extent; e != nil {
+			ch <- prometheus.MustNewConstMetric(c.extent, prometheus.GaugeValue, e.XMin, l.name, "xmin")
+			ch <- prometheus.MustNewConstMetric(c.extent, prometheus.GaugeValue, e.YMin, l.name, "ymin")
+			ch <- prometheus.MustNewConstMetric(c.extent, prometheus.GaugeValue, e.XMax, l.name, "xmax")
+			ch <- prometheus.MustNewConstMetric(c.extent, prometheus.GaugeValue, e.YMax, l.name, "ymax")
+		}
+		for level, s := range l.levels {
+			ch <- prometheus.MustNewConstMetric(c.tiles, prometheus.GaugeValue, s.tiles, l.name, level)
+			ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, s.bytes, l.name, level)
+			if l.storage != "exploded" {
+				ch <- prometheus.MustNewConstMetric(c.bundles, prometheus.GaugeValue, s.bundles, l.name, level)
+			}
+		}
+	}
+}
+
+func (c *arcgisCollector) run(ctx context.Context) {
+	for {
+		c.scan(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+func (c *arcgisCollector) scan(ctx context.Context) {
+	start := time.Now()
+	var layers []arcgisLayerStats
+	for _, src := range c.sources() {
+		if ctx.Err() != nil {
+			return
+		}
+		l, err := scanArcgisLayer(src)
+		if err != nil {
+			log.Printf("arcgis: scan failed layer=%q conf=%q err=%v", src.name, src.conf, err)
+		}
+		layers = append(layers, l)
+	}
+	c.mu.Lock()
+	c.layers = layers
+	c.lastScan = time.Now()
+	c.duration = time.Since(start)
+	c.mu.Unlock()
+}
+
+func (c *arcgisCollector) sources() []arcgisLayerSource {
+	var out []arcgisLayerSource
+	for _, p := range c.paths {
+		if p != "config" {
+			conf := p
+			if st, err := os.Stat(p); err == nil && st.IsDir() {
+				conf = filepath.Join(p, "conf.xml")
+			}
+			// ArcGIS Server keeps conf.xml in <cache>/Layers; name the layer after <cache>.
+			name := filepath.Dir(conf)
+			if strings.EqualFold(filepath.Base(name), "Layers") {
+				name = filepath.Dir(name)
+			}
+			out = append(out, arcgisLayerSource{name: filepath.Base(name), conf: conf})
+			continue
+		}
+		cfg := c.config()
+		if cfg == nil {
+			continue
+		}
+		for _, l := range cfg.Layers.Items {
+			if l.XMLName.Local == "arcgisLayer" && l.TilingScheme != "" {
+				out = append(out, arcgisLayerSource{name: l.Name, conf: l.TilingScheme, root: l.TileCachePath})
+			}
+		}
+	}
+	return out
+}
+
+func scanArcgisLayer(src arcgisLayerSource) (arcgisLayerStats, error) {
+	l := arcgisLayerStats{name: src.name, levels: map[string]*arcgisLevelStats{}}
+	data, err := os.ReadFile(src.conf)
+	if err != nil {
+		return l, err
+	}
+	if err := xml.Unmarshal(data, &l.conf); err != nil {
+		return l, fmt.Errorf("parse conf.xml: %w", err)
+	}
+	dir := filepath.Dir(src.conf)
+	if cdi, err := os.ReadFile(filepath.Join(dir, "conf.cdi")); err == nil {
+		var e arcgisExtent
+		if xml.Unmarshal(cdi, &e) == nil {
+			l.extent = &e
+		}
+	}
+
+	root := src.root
+	if root == "" {
+		root = dir
+	}
+	if st, err := os.Stat(filepath.Join(root, "_alllayers")); err == nil && st.IsDir() {
+		root = filepath.Join(root, "_alllayers")
+	}
+
+	switch {
+	case strings.HasSuffix(l.conf.StorageFormat, "CompactV2"):
+		l.storage = "compactv2"
+	case strings.HasSuffix(l.conf.StorageFormat, "Compact"):
+		l.storage = "compact"
+	default:
+		l.storage = "exploded"
+	}
+	packet := l.conf.PacketSize
+	if packet <= 0 {
+		packet = arcgisDefaultPacketSize
+	}
+	records := packet * packet
+
+	levelDirs, err := os.ReadDir(root)
+	if err != nil {
+		return l, err
+	}
+	for _, d := range levelDirs {
+		// Level directories are L00, L01, ...
+		if !d.IsDir() || len(d.Name()) < 2 || (d.Name()[0] != 'L' && d.Name()[0] != 'l') {
+			continue
+		}
+		n, err := strconv.Atoi(d.Name()[1:])
+		if err != nil {
+			continue
+		}
+		s := &arcgisLevelStats{}
+		l.levels[strconv.Itoa(n)] = s
+		levelDir := filepath.Join(root, d.Name())
+		if l.storage == "exploded" {
+			scanArcgisExploded(levelDir, s)
+			continue
+		}
+		bundles, _ := filepath.Glob(filepath.Join(levelDir, "*.bundle"))
+		for _, b := range bundles {
+			s.bundles++
+			var tiles, bytes float64
+			var err error
+			if _, statErr := os.Stat(strings.TrimSuffix(b, ".bundle") + ".bundlx"); statErr == nil {
+				tiles, bytes, err = readBundleV1(b, records)
+			} else {
+				tiles, bytes, err = readBundleV2(b, records)
+			}
+			if err != nil {
+				log.Printf("arcgis: cannot read bundle path=%q err=%v", b, err)
+				continue
+			}
+			s.tiles += tiles
+			s.bytes += bytes
+		}
+	}
+	l.ok = true
+	return l, nil
+}
+
+func scanArcgisExploded(levelDir string, s *arcgisLevelStats) {
+	_ = filepath.WalkDir(levelDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".tif", ".pbf":
+			if info, err := d.Info(); err == nil {
+				s.tiles++
+				s.bytes += float64(info.Size())
+			}
+		}
+		return nil
+	})
+}
+
+// arcgisDefaultPacketSize is the bundle edge in tiles when conf.xml has no
+// PacketSize; a bundle indexes PacketSize*PacketSize tiles.
+const arcgisDefaultPacketSize = 128
+
+// readBundleV1 reads a compact cache V1 bundle: the .bundlx index holds a
+// 5-byte little-endian bundle offset per tile (after a 16-byte header); each
+// tile in the bundle is prefixed by its 4-byte length, 0 for missing tiles.
+func readBundleV1(bundlePath string, records int) (float64, float64, error) {
+	idx, err := os.ReadFile(strings.TrimSuffix(bundlePath, ".bundle") + ".bundlx")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(idx) < 16+records*5 {
+		return 0, 0, fmt.Errorf("bundlx too short: %d bytes", len(idx))
+	}
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var tiles, bytes float64
+	buf := make([]byte, 8)
+	size := make([]byte, 4)
+	for i := 0; i < records; i++ {
+		copy(buf, idx[16+i*5:16+i*5+5])
+		buf[5], buf[6], buf[7] = 0, 0, 0
+		off := int64(binary.LittleEndian.Uint64(buf))
+		if _, err := f.ReadAt(size, off); err != nil {
+			continue
+		}
+		if n := binary.LittleEndian.Uint32(size); n > 0 {
+			tiles++
+			bytes += float64(n)
+		}
+	}
+	return tiles, bytes, nil
+}
+
+// readBundleV2 reads a compact cache V2 bundle: a 64-byte header followed by
+// 8-byte index records, 40 bits of offset and 24 bits of tile size.
+func readBundleV2(bundlePath string, records int) (float64, float64, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	idx := make([]byte, records*8)
+	if _, err := f.ReadAt(idx, 64); err != nil {
+		return 0, 0, err
+	}
+	var tiles, bytes float64
+	for i := 0; i < records; i++ {
+		if n := binary.LittleEndian.Uint64(idx[i*8:]) >> 40; n > 0 {
+			tiles++
+			bytes += float64(n)
+		}
+	}
+	return tiles, bytes, nil
+}
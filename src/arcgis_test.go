@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bundleV1 writes a compact V1 bundle and its .bundlx index; a tile of size
+// -1 gets an offset past the end of the bundle.
+func bundleV1(t *testing.T, dir string, sizes []int) string {
+	bundle := make([]byte, 60) // header, not read
+	idx := make([]byte, 16, 16+len(sizes)*5)
+	for _, n := range sizes {
+		off := uint64(len(bundle))
+		if n < 0 {
+			off = 1 << 20
+		} else {
+			bundle = binary.LittleEndian.AppendUint32(bundle, uint32(n))
+			bundle = append(bundle, make([]byte, n)...)
+		}
+		idx = append(idx, binary.LittleEndian.AppendUint64(nil, off)[:5]...)
+	}
+	path := filepath.Join(dir, "R0000C0000.bundle")
+	if err := os.WriteFile(path, bundle, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "R0000C0000.bundlx"), idx, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// bundleV2 writes a compact V2 bundle with an index record per size.
+func bundleV2(t *testing.T, dir string, sizes []int) string {
+	bundle := make([]byte, 64)
+	var tiles []byte
+	data := uint64(64 + len(sizes)*8)
+	for _, n := range sizes {
+		bundle = binary.LittleEndian.AppendUint64(bundle, data|uint64(n)<<40)
+		tiles = append(tiles, make([]byte, n)...)
+		data += uint64(n)
+	}
+	path := filepath.Join(dir, "R0000C0000.bundle")
+	if err := os.WriteFile(path, append(bundle, tiles...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBundle(t *testing.T) {
+	tests := []struct {
+		name      string
+		v2        bool
+		sizes     []int
+		records   int
+		wantTiles float64
+		wantBytes float64
+		wantErr   bool
+	}{
+		{name: "v1", sizes: []int{3, 0, 5, 0}, records: 4, wantTiles: 2, wantBytes: 8},
+		{name: "v1 offset past the bundle", sizes: []int{3, -1, 5, 0}, records: 4, wantTiles: 2, wantBytes: 8},
+		{name: "v1 empty", sizes: []int{0, 0, 0, 0}, records: 4},
+		{name: "v1 short index", sizes: []int{3, 5}, records: 4, wantErr: true},
+		{name: "v2", v2: true, sizes: []int{3, 0, 7, 0}, records: 4, wantTiles: 2, wantBytes: 10},
+		{name: "v2 empty", v2: true, sizes: []int{0, 0, 0, 0}, records: 4},
+		{name: "v2 short index", v2: true, sizes: []int{3, 5}, records: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		var tiles, bytes float64
+		var err error
+		if tt.v2 {
+			tiles, bytes, err = readBundleV2(bundleV2(t, t.TempDir(), tt.sizes), tt.records)
+		} else {
+			tiles, bytes, err = readBundleV1(bundleV1(t, t.TempDir(), tt.sizes), tt.records)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tiles != tt.wantTiles || bytes != tt.wantBytes {
+			t.Errorf("%s: got %v tiles, %v bytes; want %v, %v", tt.name, tiles, bytes, tt.wantTiles, tt.wantBytes)
+		}
+	}
+}
+
+func TestScanArcgisLayer(t *testing.T) {
+	const conf = `<CacheInfo>
+  <TileCacheInfo><SpatialReference><WKID>3857</WKID></SpatialReference>
+    <LODInfos><LODInfo><LevelID>0</LevelID></LODInfo><LODInfo><LevelID>1</LevelID></LODInfo></LODInfos>
+  </TileCacheInfo>
+  <TileImageInfo><CacheTileFormat>PNG</CacheTileFormat></TileImageInfo>
+  <CacheStorageInfo><StorageFormat>esriMapCacheStorageModeCompactV2</StorageFormat><PacketSize>2</PacketSize></CacheStorageInfo>
+</CacheInfo>`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "conf.xml"), []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "conf.cdi"), []byte(`<EnvelopeN><XMin>-10</XMin><YMin>-5</YMin><XMax>10</XMax><YMax>5</YMax></EnvelopeN>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for level, sizes := range map[string][]int{"L00": {4, 0, 0, 0}, "L01": {1, 2, 3, 4}} {
+		levelDir := filepath.Join(dir, "_alllayers", level)
+		if err := os.MkdirAll(levelDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		bundleV2(t, levelDir, sizes)
+	}
+
+	l, err := scanArcgisLayer(arcgisLayerSource{name: "roads", conf: filepath.Join(dir, "conf.xml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.ok || l.storage != "compactv2" || l.conf.WKID != "3857" || len(l.conf.LODs) != 2 {
+		t.Errorf("layer %+v", l)
+	}
+	if l.extent == nil || *l.extent != (arcgisExtent{-10, -5, 10, 5}) {
+		t.Errorf("extent %v", l.extent)
+	}
+	for level, want := range map[string]arcgisLevelStats{"0": {tiles: 1, bytes: 4, bundles: 1}, "1": {tiles: 4, bytes: 10, bundles: 1}} {
+		if got := l.levels[level]; got == nil || *got != want {
+			t.Errorf("level %s: %+v, want %+v", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"image"
+	_ "image/jpeg" // registers the decoders used by image.Decode
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	tileEmpty   = "empty"   // every pixel fully transparent
+	tileUniform = "uniform" // a single color (within JPEG noise)
+	tileContent = "content"
+)
+
+// jpegTolerance absorbs compression noise when checking for uniform tiles;
+// PNG is lossless but the same bound does no harm there.
+const jpegTolerance = 3 << 8
+
+func isRasterTile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".png", ".png8", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// classifyTileFile decodes a PNG/JPEG tile and reports whether it is empty,
+// uniform or has content.
+func classifyTileFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	return classifyTile(img), nil
+}
+
+func classifyTile(img image.Image) string {
+	b := img.Bounds()
+	if b.Empty() {
+		return tileEmpty
+	}
+
+	// Paletted PNGs: comparing indexes is enough.
+	if p, ok := img.(*image.Paletted); ok {
+		first := p.Pix[0]
+		for y := 0; y < b.Dy(); y++ {
+			row := p.Pix[y*p.Stride : y*p.Stride+b.Dx()]
+			for _, ix := range row {
+				if ix != first {
+					return tileContent
+				}
+			}
+		}
+		if _, _, _, a := p.Palette[first].RGBA(); a == 0 {
+			return tileEmpty
+		}
+		return tileUniform
+	}
+
+	r0, g0, b0, a0 := img.At(b.Min.X, b.Min.Y).RGBA()
+	transparent := a0 == 0
+	uniform := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a != 0 {
+				transparent = false
+			}
+			if uniform && (diff(r, r0) > jpegTolerance || diff(g, g0) > jpegTolerance || diff(bl, b0) > jpegTolerance || diff(a, a0) > jpegTolerance) {
+				uniform = false
+			}
+			if !transparent && !uniform {
+				return tileContent
+			}
+		}
+	}
+	if transparent {
+		return tileEmpty
+	}
+	return tileUniform
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
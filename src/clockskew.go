@@ -0,0 +1,40 @@
+package main
+
+import "time"
+
+// peakFutureGrace absorbs rounding and small clock differences before a peak
+// timestamp counts as lying in the future.
+const peakFutureGrace = time.Minute
+
+// clockSkew compares the target's idea of now (start time plus uptime, both
+// independent of the JVM time zone) with the exporter clock. The uptime is
+// only shown in whole units, so the result is as precise as
+// homeStats.uptimeResolution.
+func clockSkew(st homeStats, now time.Time) (float64, bool) {
+	if st.started <= 0 || st.uptime <= 0 {
+		return 0, false
+	}
+	return float64(st.started+st.uptime) - float64(now.UnixNano())/1e9, true
+}
+
+// inFuture reports 1 for a page timestamp later than now. A wrong JVM time
+// zone shifts the peak timestamps by whole hours and shows up here.
+func inFuture(ts int64, now time.Time) float64 {
+	if time.Unix(ts, 0).After(now.Add(peakFutureGrace)) {
+		return 1
+	}
+	return 0
+}
+
+// statsDelayExceeded reports 1 when the statistics have not changed for
+// longer than GWC's own stats delay allows. The page says its figures are
+// delayed by st.statsDelay seconds, so while the interval rows claim traffic
+// the totals must move within that delay plus the time between two scrapes
+// (a change is only seen when the page is scraped).
+func statsDelayExceeded(st homeStats, age, spacing time.Duration) float64 {
+	limit := time.Duration(st.statsDelay*float64(time.Second)) + spacing
+	if age > limit && intervalsClaimTraffic(st) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	tests := []struct {
+		st     homeStats
+		want   float64
+		wantOK bool
+	}{
+		{homeStats{started: 1_799_990_000, uptime: 10_000}, 0, true},
+		{homeStats{started: 1_799_990_000, uptime: 13_600}, 3600, true},
+		{homeStats{started: 1_799_990_000, uptime: 9_000}, -1000, true},
+		{homeStats{started: 1_799_990_000}, 0, false},
+		{homeStats{uptime: 10_000}, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := clockSkew(tt.st, now); got != tt.want || ok != tt.wantOK {
+			t.Errorf("clockSkew(%+v) = %v, %v; want %v, %v", tt.st, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestInFuture(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	tests := []struct {
+		ts   int64
+		want float64
+	}{
+		{now.Unix() - 3600, 0},
+		{now.Unix() + 30, 0},
+		{now.Unix() + 3600, 1},
+	}
+	for _, tt := range tests {
+		if got := inFuture(tt.ts, now); got != tt.want {
+			t.Errorf("inFuture(%d) = %v, want %v", tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestStatsDelayExceeded(t *testing.T) {
+	busy := []homeInterval{{window: "3 seconds", seconds: 3, requests: 12}}
+	tests := []struct {
+		name         string
+		st           homeStats
+		age, spacing time.Duration
+		want         float64
+	}{
+		{"within delay", homeStats{statsDelay: 60, intervals: busy}, 45 * time.Second, 15 * time.Second, 0},
+		{"within delay plus spacing", homeStats{statsDelay: 60, intervals: busy}, 75 * time.Second, 15 * time.Second, 0},
+		{"exceeded", homeStats{statsDelay: 60, intervals: busy}, 90 * time.Second, 15 * time.Second, 1},
+		{"no delay", homeStats{statsDelay: 0, intervals: busy}, 30 * time.Second, 15 * time.Second, 1},
+		{"idle", homeStats{statsDelay: 60}, time.Hour, 15 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := statsDelayExceeded(tt.st, tt.age, tt.spacing); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"maps"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// clusterCollector scrapes the home pages of several GWC nodes concurrently.
+// Every node gets its own gwcCollector, so per-node series look like single
+// mode plus a target label (and discovery labels); on top of that it sums
+// the counters, weights hit ratios by requests and reports version and
+// configuration drift between the nodes. Targets come from sources and can
+// change at runtime, which is why the collector is unchecked.
+type clusterCollector struct {
+	sources    []targetSource
+	newNode    func(t target, labels prometheus.Labels) *gwcCollector
+	naming     metricNaming
+	configHash bool      // fetch WMTS capabilities per node for config drift
+	auth       basicAuth // for the capabilities requests
+	timeout    time.Duration
+	retention  time.Duration // how long totals of unseen nodes are kept
+
+	mu         sync.Mutex
+	found      [][]target                    // per source
+	nodes      map[string]*gwcCollector      // by URL
+	nodeURL    []string                      // sorted keys of nodes
+	nodeLabels map[string]map[string]string  // discovery labels by URL
+	counters   *counterState                 // restart correction for nodes without a state file
+	totals     map[string]map[string]float64 // last restart-corrected counters by URL
+	totalsSeen map[string]time.Time          // last successful scrape by URL
+
+	nodes_total                *prometheus.Desc
+	nodes_up                   *prometheus.Desc
+	requests_total             *prometheus.Desc
+	untiled_wms_requests_total *prometheus.Desc
+	bytes_total                *prometheus.Desc
+	requests_rate_per_second   *prometheus.Desc
+	bandwidth_mbps             *prometheus.Desc
+	bandwidth_bytes_per_second *prometheus.Desc
+	cache_hit_ratio_percent    *prometheus.Desc
+	cache_hit_ratio            *prometheus.Desc
+	memcache_requests_total    *prometheus.Desc
+	memcache_hits_total        *prometheus.Desc
+	memcache_misses_total      *prometheus.Desc
+	memcache_evicted_total     *prometheus.Desc
+	memcache_hit_ratio         *prometheus.Desc
+	version_info               *prometheus.Desc // labels: version, build
+	version_drift              *prometheus.Desc
+	node_config_hash_info      *prometheus.Desc // labels: target, hash
+	node_config_hash_up        *prometheus.Desc // labels: target
+	config_drift               *prometheus.Desc
+}
+
+func newClusterCollector(sources []targetSource, naming metricNaming, configHash bool, auth basicAuth, timeout, retention time.Duration, newNode func(target, prometheus.Labels) *gwcCollector) *clusterCollector {
+	const ns = "gwc_cluster"
+	return &clusterCollector{
+		sources:    sources,
+		newNode:    newNode,
+		naming:     naming,
+		configHash: configHash,
+		auth:       auth,
+		timeout:    timeout,
+		retention:  retention,
+		found:      make([][]target, len(sources)),
+		nodes:      map[string]*gwcCollector{},
+		nodeLabels: map[string]map[string]string{},
+		counters:   newCounterState(retention),
+		totals:     map[string]map[string]float64{},
+		totalsSeen: map[string]time.Time{},
+
+		nodes_total:                prometheus.NewDesc(ns+"_nodes", "GWC nodes currently discovered.", nil, nil),
+		nodes_up:                   prometheus.NewDesc(ns+"_nodes_up", "GWC nodes whose home page was scraped successfully.", nil, nil),
+		requests_total:             prometheus.NewDesc(ns+"_requests_total", "Sum of total requests over all nodes seen, corrected for node restarts.", nil, nil),
+		untiled_wms_requests_total: prometheus.NewDesc(ns+"_untiled_wms_requests_total", "Sum of untiled WMS requests over all nodes seen, corrected for node restarts.", nil, nil),
+		bytes_total:                prometheus.NewDesc(ns+"_bytes_total", "Sum of bytes served over all nodes seen, corrected for node restarts.", nil, nil),
+		requests_rate_per_second:   prometheus.NewDesc(ns+"_requests_rate_per_second", "Sum of the lifetime request rates of the reachable nodes.", nil, nil),
+		bandwidth_mbps:             prometheus.NewDesc(ns+"_bandwidth_mbps", "Sum of the lifetime bandwidth of the reachable nodes in Mbps.", nil, nil),
+		bandwidth_bytes_per_second: prometheus.NewDesc(ns+"_bandwidth_bytes_per_second", "Sum of the lifetime bandwidth of the reachable nodes.", nil, nil),
+		cache_hit_ratio_percent:    prometheus.NewDesc(ns+"_cache_hit_ratio_percent", "Cache hit ratio over all requests of the reachable nodes (weighted by requests).", nil, nil),
+		cache_hit_ratio:            prometheus.NewDesc(ns+"_cache_hit_ratio", "Cache hit ratio (0-1) over all requests of the reachable nodes (weighted by requests).", nil, nil),
+		memcache_requests_total:    prometheus.NewDesc(ns+"_memcache_requests_total", "Sum of in-memory cache requests over all nodes seen, corrected for node restarts.", nil, nil),
+		memcache_hits_total:        prometheus.NewDesc(ns+"_memcache_hits_total", "Sum of in-memory cache hits over all nodes seen, corrected for node restarts.", nil, nil),
+		memcache_misses_total:      prometheus.NewDesc(ns+"_memcache_misses_total", "Sum of in-memory cache misses over all nodes seen, corrected for node restarts.", nil, nil),
+		memcache_evicted_total:     prometheus.NewDesc(ns+"_memcache_evicted_tiles_total", "Sum of tiles evicted from the in-memory caches of all nodes seen, corrected for node restarts.", nil, nil),
+		memcache_hit_ratio:         prometheus.NewDesc(ns+"_memcache_hit_ratio", "In-memory cache hits divided by in-memory cache requests over all nodes seen (0-1).", nil, nil),
+		version_info:               prometheus.NewDesc(ns+"_version_info", "Reachable nodes per GWC version and build.", []string{"version", "build"}, nil),
+		version_drift:              prometheus.NewDesc(ns+"_version_drift", "1 if the reachable nodes run more than one GWC version or build, else 0.", nil, nil),
+		node_config_hash_info:      prometheus.NewDesc(ns+"_node_config_hash_info", "Hash (sha256 prefix) of the node's WMTS capabilities with its own address removed; value 1.", []string{"target", "hash"}, nil),
+		node_config_hash_up:        prometheus.NewDesc(ns+"_node_config_hash_up", "1 if the node's WMTS capabilities could be fetched and hashed, else 0.", []string{"target"}, nil),
+		config_drift:               prometheus.NewDesc(ns+"_config_drift", "1 if the nodes' WMTS capabilities hashes differ, else 0.", nil, nil),
+	}
+}
+
+// run starts the target sources; it returns immediately.
+func (c *clusterCollector) run(ctx context.Context) {
+	for i, s := range c.sources {
+		go s.run(ctx, func(targets []target) { c.update(i, targets) })
+	}
+}
+
+// update replaces the targets of one source and creates or drops node
+// collectors. Nodes that stay keep their state (hit/miss marks, peaks, ...);
+// a node whose labels changed is replaced.
+func (c *clusterCollector) update(source int, targets []target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.found[source] = targets
+
+	want := map[string]target{}
+	for _, ts := range c.found {
+		for _, t := range ts {
+			if _, dup := want[t.url]; !dup {
+				want[t.url] = t
+			}
+		}
+	}
+	for u := range c.nodes {
+		t, ok := want[u]
+		if !ok {
+			delete(c.nodes, u)
+			delete(c.nodeLabels, u)
+			log.Printf("cluster: node removed target=%q", u)
+		} else if !maps.Equal(t.labels, c.nodeLabels[u]) {
+			delete(c.nodes, u)
+			log.Printf("cluster: node labels changed target=%q", u)
+		}
+	}
+	for u, t := range want {
+		if _, ok := c.nodes[u]; ok {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for k, v := range t.labels {
+			labels[k] = v
+		}
+		labels["target"] = targetLabel(u)
+		c.nodes[u] = c.newNode(t, labels)
+		c.nodeLabels[u] = t.labels
+		log.Printf("cluster: node added target=%q", u)
+	}
+	c.nodeURL = c.nodeURL[:0]
+	for u := range c.nodes {
+		c.nodeURL = append(c.nodeURL, u)
+	}
+	sort.Strings(c.nodeURL)
+}
+
+// targetLabel is host:port of a home page URL.
+func targetLabel(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return raw
+}
+
+func (c *clusterCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	nodes := make([]*gwcCollector, 0, len(c.nodeURL))
+	for _, u := range c.nodeURL {
+		nodes = append(nodes, c.nodes[u])
+	}
+	c.mu.Unlock()
+
+	stats := make([]homeStats, len(nodes))
+	errs := make([]error, len(nodes))
+	hashes := make([]string, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = n.scrape()
+			if c.configHash && errs[i] == nil {
+				hashes[i] = c.capabilitiesHash(n.targetURL)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cumulative := make([]map[string]float64, len(nodes))
+	for i, n := range nodes {
+		cumulative[i] = n.collectStats(ch, stats[i], errs[i])
+		if errs[i] == nil && cumulative[i] == nil {
+			cumulative[i], _, _ = c.counters.observe(n.targetURL, stats[i].started, counterValues(stats[i]))
+		}
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	for i, n := range nodes {
+		if errs[i] == nil {
+			c.totals[n.targetURL] = cumulative[i]
+			c.totalsSeen[n.targetURL] = now
+		}
+	}
+	for u, seen := range c.totalsSeen {
+		if c.retention > 0 && now.Sub(seen) > c.retention {
+			delete(c.totals, u)
+			delete(c.totalsSeen, u)
+		}
+	}
+	totals := map[string]float64{}
+	for _, t := range c.totals {
+		for name, v := range t {
+			totals[name] += v
+		}
+	}
+	c.mu.Unlock()
+	c.collectCluster(ch, nodes, stats, errs, hashes, totals)
+}
+
+// collectCluster emits the cluster series. The counter sums are totals,
+// the restart-corrected counters of every node seen so far by their last
+// scrape: nodes that are down or were removed keep their share, so the sums
+// only drop when the exporter restarts or a node was not scraped for the
+// retention.
+func (c *clusterCollector) collectCluster(ch chan<- prometheus.Metric, nodes []*gwcCollector, stats []homeStats, errs []error, hashes []string, totals map[string]float64) {
+	var (
+		up                       int
+		rate, mbps               float64
+		hitWeighted, hitRequests float64
+		versions                 = map[[2]string]int{}
+		configs                  = map[string]bool{}
+	)
+	if c.configHash {
+		for i, n := range nodes {
+			ok := 0.0
+			if hashes[i] != "" {
+				ok = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.node_config_hash_up, prometheus.GaugeValue, ok, targetLabel(n.targetURL))
+		}
+	}
+	sum := func(total *float64, v float64) {
+		if v >= 0 {
+			*total += v
+		}
+	}
+	for i, st := range stats {
+		if errs[i] != nil {
+			continue
+		}
+		up++
+		sum(&rate, st.requestRate)
+		sum(&mbps, st.bandwidthMbps)
+		if st.requests >= 0 && st.cacheHitPercent >= 0 {
+			hitWeighted += st.requests * st.cacheHitPercent / 100
+			hitRequests += st.requests
+		}
+		if st.version != "" || st.build != "" {
+			versions[[2]string{st.version, st.build}]++
+		}
+		if hashes[i] != "" {
+			configs[hashes[i]] = true
+			ch <- prometheus.MustNewConstMetric(c.node_config_hash_info, prometheus.GaugeValue, 1, targetLabel(nodes[i].targetURL), hashes[i])
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.nodes_total, prometheus.GaugeValue, float64(len(nodes)))
+	ch <- prometheus.MustNewConstMetric(c.nodes_up, prometheus.GaugeValue, float64(up))
+	counter := func(desc *prometheus.Desc, name string) {
+		if v, ok := totals[name]; ok {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+		}
+	}
+	counter(c.requests_total, "requests")
+	counter(c.untiled_wms_requests_total, "untiled_wms_requests")
+	counter(c.bytes_total, "bytes")
+	counter(c.memcache_requests_total, "memcache_requests")
+	counter(c.memcache_hits_total, "memcache_hit_count")
+	counter(c.memcache_misses_total, "memcache_miss_count")
+	counter(c.memcache_evicted_total, "memcache_evicted_tiles")
+	if totals["memcache_requests"] > 0 {
+		ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio, prometheus.GaugeValue, totals["memcache_hit_count"]/totals["memcache_requests"])
+	}
+	if up == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.requests_rate_per_second, prometheus.GaugeValue, rate)
+	if c.naming.legacyNames() {
+		ch <- prometheus.MustNewConstMetric(c.bandwidth_mbps, prometheus.GaugeValue, mbps)
+	}
+	if c.naming.v2 {
+		ch <- prometheus.MustNewConstMetric(c.bandwidth_bytes_per_second, prometheus.GaugeValue, mbpsToBytes(mbps))
+	}
+	if hitRequests > 0 {
+		if c.naming.legacyNames() {
+			ch <- prometheus.MustNewConstMetric(c.cache_hit_ratio_percent, prometheus.GaugeValue, hitWeighted/hitRequests*100)
+		}
+		if c.naming.v2 {
+			ch <- prometheus.MustNewConstMetric(c.cache_hit_ratio, prometheus.GaugeValue, hitWeighted/hitRequests)
+		}
+	}
+
+	for vb, n := range versions {
+		ch <- prometheus.MustNewConstMetric(c.version_info, prometheus.GaugeValue, float64(n), vb[0], vb[1])
+	}
+	ch <- prometheus.MustNewConstMetric(c.version_drift, prometheus.GaugeValue, drift(len(versions)))
+	if c.configHash && len(configs) > 0 {
+		ch <- prometheus.MustNewConstMetric(c.config_drift, prometheus.GaugeValue, drift(len(configs)))
+	}
+}
+
+func drift(distinct int) float64 {
+	if distinct > 1 {
+		return 1
+	}
+	return 0
+}
+
+// capabilitiesHash fingerprints a node's layer and grid set configuration by
+// hashing its WMTS capabilities. GWC writes the requested address into the
+// document, so that is removed first to make nodes comparable.
+func (c *clusterCollector) capabilitiesHash(targetURL string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	capsURL := gwcServiceURL(targetURL, "/service/wmts?REQUEST=GetCapabilities")
+	body, err := fetchURL(ctx, capsURL, c.auth)
+	if err != nil {
+		log.Printf("cluster: capabilities failed target=%q err=%v", capsURL, err)
+		return ""
+	}
+	doc := string(body)
+	if u, err := url.Parse(targetURL); err == nil {
+		doc = strings.ReplaceAll(doc, u.Scheme+"://"+u.Host, "")
+	}
+	sum := sha256.Sum256([]byte(doc))
+	return hex.EncodeToString(sum[:])[:16]
+}
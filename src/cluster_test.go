@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeNode serves a GWC home page with a settable request counter.
+type fakeNode struct {
+	*httptest.Server
+	requests atomic.Int64
+	down     atomic.Bool
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	n := &fakeNode{}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("<table><tr><th>Total number of requests:</th><td>" + strconv.FormatInt(n.requests.Load(), 10) + "</td></tr></table>"))
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func newTestClusterCollector(state *counterState, retention time.Duration) *clusterCollector {
+	return newClusterCollector([]targetSource{staticSource{}}, metricNaming{}, false, basicAuth{}, 5*time.Second, retention, func(t target, labels prometheus.Labels) *gwcCollector {
+		return newGwcCollector(t.url, 5*time.Second, state, metricNaming{}, 0, newPeakTracker(0, false, 0), labels)
+	})
+}
+
+// clusterRequests collects c and returns gwc_cluster_requests_total.
+func clusterRequests(t *testing.T, c *clusterCollector) float64 {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "gwc_cluster_requests_total" {
+			return mf.Metric[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatal("gwc_cluster_requests_total missing")
+	return 0
+}
+
+// The cluster sums keep the share of nodes that restart, go down or are
+// removed, with and without a state file.
+func TestClusterCollectorSums(t *testing.T) {
+	type step struct {
+		a, b    int64 // requests on the page; -1 is down
+		listed  bool  // b still discovered
+		wantSum float64
+		note    string
+	}
+	steps := []step{
+		{10, 20, true, 30, "both up"},
+		{15, -1, true, 35, "b down keeps its share"},
+		{15, 5, true, 40, "b restarted"},
+		{15, 5, false, 40, "b removed keeps its share"},
+		{20, 5, false, 45, "a grows"},
+	}
+	for _, withState := range []bool{false, true} {
+		var state *counterState
+		if withState {
+			var err error
+			if state, err = loadCounterState(filepath.Join(t.TempDir(), "state.json"), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a, b := newFakeNode(t), newFakeNode(t)
+		c := newTestClusterCollector(state, 0)
+		for i, s := range steps {
+			targets := []target{{url: a.URL}}
+			if s.listed {
+				targets = append(targets, target{url: b.URL})
+			}
+			c.update(0, targets)
+			a.requests.Store(s.a)
+			b.down.Store(s.b < 0)
+			if s.b >= 0 {
+				b.requests.Store(s.b)
+			}
+			if got := clusterRequests(t, c); got != s.wantSum {
+				t.Errorf("state file %v, step %d (%s): requests_total %v, want %v", withState, i, s.note, got, s.wantSum)
+			}
+		}
+	}
+}
+
+func TestClusterCollectorRetention(t *testing.T) {
+	a, b := newFakeNode(t), newFakeNode(t)
+	a.requests.Store(10)
+	b.requests.Store(20)
+	c := newTestClusterCollector(nil, time.Hour)
+	c.update(0, []target{{url: a.URL}, {url: b.URL}})
+	if got := clusterRequests(t, c); got != 30 {
+		t.Fatalf("requests_total %v, want 30", got)
+	}
+
+	c.update(0, []target{{url: a.URL}})
+	c.totalsSeen[b.URL] = time.Now().Add(-30 * time.Minute)
+	if got := clusterRequests(t, c); got != 30 {
+		t.Errorf("within retention: requests_total %v, want 30", got)
+	}
+	c.totalsSeen[b.URL] = time.Now().Add(-2 * time.Hour)
+	if got := clusterRequests(t, c); got != 10 {
+		t.Errorf("past retention: requests_total %v, want 10", got)
+	}
+	if _, ok := c.totals[b.URL]; ok {
+		t.Error("totals of the removed node were kept")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// counterState keeps GWC's lifetime counters rising across GWC restarts. For
+// every target it remembers the last value of each counter and an offset that
+// grows by that value whenever the target restarts. The state is written to a
+// JSON file after every scrape so exporter restarts keep it as well. Targets
+// not scraped for retention are dropped, so discovery churn (e.g. new pod
+// IPs) does not grow the state forever.
+type counterState struct {
+	path      string
+	retention time.Duration // 0 keeps targets forever
+
+	mu      sync.Mutex
+	targets map[string]*targetCounters
+}
+
+type targetCounters struct {
+	Seen     int64                     `json:"seen_seconds"` // last observe
+	Started  int64                     `json:"started_seconds"`
+	Restarts float64                   `json:"restarts"`
+	Counters map[string]*counterOffset `json:"counters"`
+	HitMiss  *hitMissState             `json:"hit_miss,omitempty"`
+}
+
+type counterOffset struct {
+	Last   float64 `json:"last"`
+	Offset float64 `json:"offset"`
+}
+
+type counterStateFile struct {
+	Version int                        `json:"version"`
+	Targets map[string]*targetCounters `json:"targets"`
+}
+
+// newCounterState returns a state that is kept in memory only.
+func newCounterState(retention time.Duration) *counterState {
+	return &counterState{retention: retention, targets: map[string]*targetCounters{}}
+}
+
+func loadCounterState(path string, retention time.Duration) (*counterState, error) {
+	s := &counterState{path: path, retention: retention, targets: map[string]*targetCounters{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f counterStateFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	for target, t := range f.Targets {
+		if t.Counters == nil {
+			t.Counters = map[string]*counterOffset{}
+		}
+		if t.Seen == 0 {
+			t.Seen = time.Now().Unix() // written before seen_seconds existed
+		}
+		s.targets[target] = t
+	}
+	return s, nil
+}
+
+// observe records the counters of one scrape of target. A target counts as
+// restarted when its start time changed or any counter went down; the
+// returned values are the counters plus everything seen before restarts.
+func (s *counterState) observe(target string, started int64, values map[string]float64) (cumulative map[string]float64, restarts float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	t := s.targets[target]
+	if t == nil {
+		t = &targetCounters{Started: started, Counters: map[string]*counterOffset{}}
+		s.targets[target] = t
+	}
+	t.Seen = now.Unix()
+
+	reset := started != 0 && t.Started != 0 && started != t.Started
+	for name, v := range values {
+		if co := t.Counters[name]; co != nil && v < co.Last {
+			reset = true
+		}
+	}
+	if reset {
+		t.Restarts++
+		for _, co := range t.Counters {
+			co.Offset += co.Last
+			co.Last = 0
+		}
+	}
+	if started != 0 {
+		t.Started = started
+	}
+
+	cumulative = make(map[string]float64, len(values))
+	for name, v := range values {
+		co := t.Counters[name]
+		if co == nil {
+			co = &counterOffset{}
+			t.Counters[name] = co
+		}
+		co.Last = v
+		cumulative[name] = co.Offset + v
+	}
+	s.prune(now)
+	return cumulative, t.Restarts, s.save()
+}
+
+// hitMiss returns the cache hit and miss marks stored for target, or the
+// zero state for a target not seen yet.
+func (s *counterState) hitMiss(target string) hitMissState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.targets[target]; t != nil && t.HitMiss != nil {
+		return *t.HitMiss
+	}
+	return hitMissState{}
+}
+
+// setHitMiss stores the cache hit and miss marks of target; they are written
+// with the next observe.
+func (s *counterState) setHitMiss(target string, hm hitMissState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.targets[target]
+	if t == nil {
+		t = &targetCounters{Seen: time.Now().Unix(), Counters: map[string]*counterOffset{}}
+		s.targets[target] = t
+	}
+	t.HitMiss = &hm
+}
+
+// prune drops the targets not observed within the retention before now.
+// The caller holds s.mu.
+func (s *counterState) prune(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention).Unix()
+	for target, t := range s.targets {
+		if t.Seen < cutoff {
+			delete(s.targets, target)
+		}
+	}
+}
+
+// save writes the state next to its final path and renames it into place so
+// a crash never leaves a truncated file.
+func (s *counterState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(counterStateFile{Version: 1, Targets: s.targets}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCounterStateObserve(t *testing.T) {
+	type scrape struct {
+		started      int64
+		values       map[string]float64
+		want         map[string]float64
+		wantRestarts float64
+	}
+	tests := []struct {
+		name    string
+		scrapes []scrape
+	}{
+		{
+			name: "rising",
+			scrapes: []scrape{
+				{100, map[string]float64{"requests": 10}, map[string]float64{"requests": 10}, 0},
+				{100, map[string]float64{"requests": 25}, map[string]float64{"requests": 25}, 0},
+			},
+		},
+		{
+			name: "restart by start time",
+			scrapes: []scrape{
+				{100, map[string]float64{"requests": 50, "bytes": 1000}, map[string]float64{"requests": 50, "bytes": 1000}, 0},
+				{200, map[string]float64{"requests": 60, "bytes": 1200}, map[string]float64{"requests": 110, "bytes": 2200}, 1},
+				{200, map[string]float64{"requests": 70, "bytes": 1300}, map[string]float64{"requests": 120, "bytes": 2300}, 1},
+			},
+		},
+		{
+			name: "restart by counter going down",
+			scrapes: []scrape{
+				{0, map[string]float64{"requests": 50, "bytes": 1000}, map[string]float64{"requests": 50, "bytes": 1000}, 0},
+				{0, map[string]float64{"requests": 5, "bytes": 2000}, map[string]float64{"requests": 55, "bytes": 3000}, 1},
+			},
+		},
+		{
+			name: "two restarts",
+			scrapes: []scrape{
+				{100, map[string]float64{"requests": 10}, map[string]float64{"requests": 10}, 0},
+				{200, map[string]float64{"requests": 20}, map[string]float64{"requests": 30}, 1},
+				{300, map[string]float64{"requests": 5}, map[string]float64{"requests": 35}, 2},
+			},
+		},
+		{
+			name: "unknown start time keeps the known one",
+			scrapes: []scrape{
+				{100, map[string]float64{"requests": 10}, map[string]float64{"requests": 10}, 0},
+				{0, map[string]float64{"requests": 12}, map[string]float64{"requests": 12}, 0},
+				{100, map[string]float64{"requests": 14}, map[string]float64{"requests": 14}, 0},
+			},
+		},
+		{
+			name: "counter appearing later",
+			scrapes: []scrape{
+				{100, map[string]float64{"requests": 10}, map[string]float64{"requests": 10}, 0},
+				{100, map[string]float64{"requests": 11, "memcache_requests": 3}, map[string]float64{"requests": 11, "memcache_requests": 3}, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		s := newCounterState(0)
+		for i, sc := range tt.scrapes {
+			got, restarts, err := s.observe("http://gwc:8080/geowebcache", sc.started, sc.values)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(got, sc.want) || restarts != sc.wantRestarts {
+				t.Errorf("%s, scrape %d: got %v, %v restarts; want %v, %v", tt.name, i, got, restarts, sc.want, sc.wantRestarts)
+			}
+		}
+	}
+}
+
+func TestCounterStateFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadCounterState(path, 0)
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if _, _, err := s.observe("a", 100, map[string]float64{"requests": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.observe("a", 200, map[string]float64{"requests": 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An exporter restart reads the offsets back.
+	s, err = loadCounterState(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, restarts, err := s.observe("a", 200, map[string]float64{"requests": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["requests"] != 70 || restarts != 1 {
+		t.Errorf("after reload got %v, %v restarts; want requests 70, 1 restart", got, restarts)
+	}
+	if matches, _ := filepath.Glob(path + ".*.tmp"); len(matches) > 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCounterState(path, 0); err == nil {
+		t.Error("corrupt file loaded without error")
+	}
+}
+
+func TestCounterStatePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadCounterState(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"old", "recent", "current"} {
+		if _, _, err := s.observe(target, 100, map[string]float64{"requests": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	s.targets["old"].Seen = now.Add(-2 * time.Hour).Unix()
+	s.targets["recent"].Seen = now.Add(-30 * time.Minute).Unix()
+
+	if _, _, err := s.observe("current", 100, map[string]float64{"requests": 2}); err != nil {
+		t.Fatal(err)
+	}
+	s, err = loadCounterState(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.targets["old"]; ok {
+		t.Error("target unseen for longer than the retention was kept")
+	}
+	if _, ok := s.targets["recent"]; !ok {
+		t.Error("recent target was dropped")
+	}
+
+	forever := newCounterState(0)
+	forever.targets["old"] = &targetCounters{Seen: 1, Counters: map[string]*counterOffset{}}
+	forever.prune(now)
+	if _, ok := forever.targets["old"]; !ok {
+		t.Error("retention 0 dropped a target")
+	}
+}
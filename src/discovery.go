@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// target is a GWC home page to scrape and the labels its series get.
+type target struct {
+	url    string
+	labels map[string]string
+}
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedTargetLabels are set by cluster mode or used as variable labels of
+// the home page metrics; a target label with the same name would clash.
+var reservedTargetLabels = map[string]bool{
+	"target": true, "window": true, "window_seconds": true, "field": true,
+	"kind": true, "peak": true, "version": true, "build": true, "hash": true,
+}
+
+// checkTargetLabels validates labels from a target spec or file_sd file.
+func checkTargetLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if reservedTargetLabels[name] {
+			return fmt.Errorf("label name %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// targetSource provides targets for cluster mode. run keeps the list up to
+// date and calls update with the full list whenever it was refreshed.
+type targetSource interface {
+	run(ctx context.Context, update func([]target))
+}
+
+// staticSource is a fixed list of home page URLs.
+type staticSource []target
+
+func (s staticSource) run(_ context.Context, update func([]target)) {
+	update(s)
+}
+
+// dnsSource resolves a host name to targets: A/AAAA records keep the port of
+// the URL, SRV records provide host and port.
+type dnsSource struct {
+	scheme   string // http or https
+	host     string // A/AAAA or SRV name
+	port     string // empty for SRV
+	path     string // path and query after host:port
+	srv      bool
+	labels   map[string]string // added to every resolved target
+	interval time.Duration
+	resolver *net.Resolver
+}
+
+// parseTargetSpecs turns -cluster.target values into sources. Plain URLs are
+// static targets; dns+<url> resolves the host as A/AAAA records and
+// dnssrv+<url> as an SRV record (e.g. dnssrv+http://_http._tcp.gwc/geowebcache).
+// name=value pairs after the URL, separated by spaces, become labels of the
+// target or of every resolved target.
+func parseTargetSpecs(specs []string, refresh time.Duration) ([]targetSource, error) {
+	var static staticSource
+	var sources []targetSource
+	for _, spec := range specs {
+		words := strings.Fields(spec)
+		if len(words) == 0 {
+			continue
+		}
+		spec = words[0]
+		var labels map[string]string
+		for _, w := range words[1:] {
+			name, value, ok := strings.Cut(w, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid label %q in target %q (want name=value)", w, spec)
+			}
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[name] = value
+		}
+		if err := checkTargetLabels(labels); err != nil {
+			return nil, fmt.Errorf("target %q: %v", spec, err)
+		}
+		kind, raw, found := strings.Cut(spec, "+")
+		if !found || strings.Contains(kind, ":") {
+			kind, raw = "", spec
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid target %q (want http(s)://host[:port]/path, optionally prefixed by dns+ or dnssrv+)", spec)
+		}
+		path := u.EscapedPath()
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		switch kind {
+		case "":
+			static = append(static, target{url: raw, labels: labels})
+		case "dns":
+			port := u.Port()
+			if port == "" {
+				port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+			}
+			sources = append(sources, &dnsSource{scheme: u.Scheme, host: u.Hostname(), port: port, path: path, labels: labels, interval: refresh, resolver: net.DefaultResolver})
+		case "dnssrv":
+			sources = append(sources, &dnsSource{scheme: u.Scheme, host: u.Hostname(), path: path, srv: true, labels: labels, interval: refresh, resolver: net.DefaultResolver})
+		default:
+			return nil, fmt.Errorf("unknown discovery %q in target %q (want dns or dnssrv)", kind, spec)
+		}
+	}
+	if len(static) > 0 {
+		sources = append([]targetSource{static}, sources...)
+	}
+	return sources, nil
+}
+
+func (s *dnsSource) run(ctx context.Context, update func([]target)) {
+	for {
+		targets, err := s.resolve(ctx)
+		if err != nil {
+			// Keep the previous targets; a DNS hiccup should not drop nodes.
+			log.Printf("dns discovery: lookup failed name=%q err=%v", s.host, err)
+		} else {
+			update(targets)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+func (s *dnsSource) resolve(ctx context.Context) ([]target, error) {
+	var hostPorts []string
+	if s.srv {
+		_, addrs, err := s.resolver.LookupSRV(ctx, "", "", s.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			hostPorts = append(hostPorts, net.JoinHostPort(strings.TrimSuffix(a.Target, "."), strconv.Itoa(int(a.Port))))
+		}
+	} else {
+		addrs, err := s.resolver.LookupHost(ctx, s.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			hostPorts = append(hostPorts, net.JoinHostPort(a, s.port))
+		}
+	}
+	sort.Strings(hostPorts)
+	targets := make([]target, 0, len(hostPorts))
+	for _, hp := range hostPorts {
+		targets = append(targets, target{url: s.scheme + "://" + hp + s.path, labels: s.labels})
+	}
+	return targets, nil
+}
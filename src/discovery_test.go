@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTargetSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    []targetSource
+		wantErr bool
+	}{
+		{name: "none"},
+		{
+			name:  "static",
+			specs: []string{"http://gwc-1:8080/geowebcache", "  ", "https://gwc-2/geowebcache/home site=east rack=b"},
+			want: []targetSource{staticSource{
+				{url: "http://gwc-1:8080/geowebcache"},
+				{url: "https://gwc-2/geowebcache/home", labels: map[string]string{"site": "east", "rack": "b"}},
+			}},
+		},
+		{
+			name:  "dns",
+			specs: []string{"dns+https://gwc.internal/geowebcache?x=1 site=east"},
+			want: []targetSource{&dnsSource{
+				scheme: "https", host: "gwc.internal", port: "443", path: "/geowebcache?x=1",
+				labels: map[string]string{"site": "east"}, interval: time.Minute,
+			}},
+		},
+		{
+			name:  "dnssrv after static",
+			specs: []string{"dnssrv+http://_http._tcp.gwc/geowebcache", "http://gwc-1:8080/geowebcache"},
+			want: []targetSource{
+				staticSource{{url: "http://gwc-1:8080/geowebcache"}},
+				&dnsSource{scheme: "http", host: "_http._tcp.gwc", path: "/geowebcache", srv: true, interval: time.Minute},
+			},
+		},
+		{name: "label without value", specs: []string{"http://gwc-1:8080/geowebcache site"}, wantErr: true},
+		{name: "reserved label", specs: []string{"http://gwc-1:8080/geowebcache target=x"}, wantErr: true},
+		{name: "internal label", specs: []string{"http://gwc-1:8080/geowebcache __scheme__=https"}, wantErr: true},
+		{name: "invalid label name", specs: []string{"http://gwc-1:8080/geowebcache data-center=x"}, wantErr: true},
+		{name: "no scheme", specs: []string{"gwc-1:8080/geowebcache"}, wantErr: true},
+		{name: "bad scheme", specs: []string{"ftp://gwc-1/geowebcache"}, wantErr: true},
+		{name: "unknown discovery", specs: []string{"consul+http://gwc/geowebcache"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTargetSpecs(tt.specs, time.Minute)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, s := range got {
+			if d, ok := s.(*dnsSource); ok {
+				if d.resolver == nil {
+					t.Errorf("%s: dns source without resolver", tt.name)
+				}
+				d.resolver = nil
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
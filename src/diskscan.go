@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tile age buckets: 1h, 6h, 1d, 7d, 30d, 90d, 1y.
+var diskAgeBuckets = []float64{3600, 6 * 3600, 86400, 7 * 86400, 30 * 86400, 90 * 86400, 365 * 86400}
+
+// GWC's file blob store puts tiles at
+// {layer}/{gridset}_{zz}[_{parameters sha1}]/{x/2^k}_{y/2^k}/{x}_{y}.{ext}.
+var diskZoomDirRe = regexp.MustCompile(`^(.+)_([0-9]{2,})(?:_[0-9a-f]{40})?$`)
+
+type diskTileKey struct {
+	layer, gridset, zoom string
+}
+
+type diskTileStats struct {
+	tiles   float64
+	bytes   float64
+	expired float64
+	ageSum  float64
+	ageHist []uint64 // per diskAgeBuckets, not cumulative
+
+	sampled float64 // tiles decoded for the blank tile analysis
+	empty   float64
+	uniform float64
+}
+
+// diskScanCollector walks GWC file blob stores in the background and exports
+// tile counts, bytes and tile age per layer/gridset/zoom. Tiles older than the
+// layer's expireCache (from geowebcache.xml) are counted as expired.
+//
+// With a sample rate set, a random share of PNG/JPEG tiles is decoded and
+// classified as empty, uniform or content. Decoding stops for the rest of the
+// scan once blankBudget is used up so a large cache cannot pin a CPU.
+type diskScanCollector struct {
+	paths     []string // directories; "auto" = Local Storage from the home page, "config" = file blob stores
+	homePaths func() (configFile, localStorage string)
+	config    func() *gwcConfig
+	interval  time.Duration
+
+	blankSampleRate float64
+	blankBudget     time.Duration
+
+	mu             sync.Mutex
+	tiles          map[diskTileKey]*diskTileStats
+	lastScan       time.Time
+	duration       time.Duration
+	blankExhausted bool
+
+	layer_tiles    *prometheus.Desc // labels: layer, gridset, zoom
+	layer_bytes    *prometheus.Desc // labels: layer, gridset, zoom
+	tile_age       *prometheus.Desc // labels: layer, zoom
+	tiles_expired  *prometheus.Desc // label: layer
+	scan_duration  *prometheus.Desc
+	scan_timestamp *prometheus.Desc
+	sampled_tiles  *prometheus.Desc // labels: layer, zoom, class
+	blank_ratio    *prometheus.Desc // labels: layer, zoom
+	blank_budget   *prometheus.Desc
+}
+
+func newDiskScanCollector(paths []string, homePaths func() (string, string), config func() *gwcConfig, interval time.Duration, blankSampleRate float64, blankBudget time.Duration) *diskScanCollector {
+	const ns = "gwc_disk"
+	return &diskScanCollector{
+		paths:     paths,
+		homePaths: homePaths,
+		config:    config,
+		interval:  interval,
+
+		blankSampleRate: blankSampleRate,
+		blankBudget:     blankBudget,
+
+		layer_tiles:    prometheus.NewDesc(ns+"_tiles", "Tiles in the file blob store per layer, grid set and zoom.", []string{"layer", "gridset", "zoom"}, nil),
+		layer_bytes:    prometheus.NewDesc(ns+"_bytes", "Tile bytes in the file blob store per layer, grid set and zoom.", []string{"layer", "gridset", "zoom"}, nil),
+		tile_age:       prometheus.NewDesc(ns+"_tile_age_seconds", "Age of cached tiles (scan time minus mtime) per layer and zoom.", []string{"layer", "zoom"}, nil),
+		tiles_expired:  prometheus.NewDesc(ns+"_tiles_expired", "Tiles older than the layer's configured expireCache.", []string{"layer"}, nil),
+		scan_duration:  prometheus.NewDesc(ns+"_scan_duration_seconds", "Duration of the last file blob store scan.", nil, nil),
+		scan_timestamp: prometheus.NewDesc(ns+"_last_scan_timestamp_seconds", "Unix time the last file blob store scan finished.", nil, nil),
+		sampled_tiles:  prometheus.NewDesc(ns+"_sampled_tiles", "Tiles decoded by the blank tile analysis in the last scan, by class (empty, uniform, content).", []string{"layer", "zoom", "class"}, nil),
+		blank_ratio:    prometheus.NewDesc(ns+"_blank_tiles_ratio", "Share of sampled tiles that are empty or a single color.", []string{"layer", "zoom"}, nil),
+		blank_budget:   prometheus.NewDesc(ns+"_blank_sample_budget_exhausted", "1 if the last scan stopped sampling because the CPU budget was used up, else 0.", nil, nil),
+	}
+}
+
+func (c *diskScanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.layer_tiles
+	ch <- c.layer_bytes
+	ch <- c.tile_age
+	ch <- c.tiles_expired
+	ch <- c.scan_duration
+	ch <- c.scan_timestamp
+	ch <- c.sampled_tiles
+	ch <- c.blank_ratio
+	ch <- c.blank_budget
+}
+
+func (c *diskScanCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastScan.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.scan_duration, prometheus.GaugeValue, c.duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.scan_timestamp, prometheus.GaugeValue, float64(c.lastScan.Unix()))
+	if c.blankSampleRate > 0 {
+		exhausted := 0.0
+		if c.blankExhausted {
+			exhausted = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.blank_budget, prometheus.GaugeValue, exhausted)
+	}
+
+	type layerZoom struct{ layer, zoom string }
+	ages := map[layerZoom]*diskTileStats{}
+	expired := map[string]float64{}
+	for k, s := range c.tiles {
+		ch <- prometheus.MustNewConstMetric(c.layer_tiles, prometheus.GaugeValue, s.tiles, k.layer, k.gridset, k.zoom)
+		ch <- prometheus.MustNewConstMetric(c.layer_bytes, prometheus.GaugeValue, s.bytes, k.layer, k.gridset, k.zoom)
+		expired[k.layer] += s.expired
+
+		a := ages[layerZoom{k.layer, k.zoom}]
+		if a == nil {
+			a = &diskTileStats{ageHist: make([]uint64, len(diskAgeBuckets))}
+			ages[layerZoom{k.layer, k.zoom}] = a
+		}
+		a.tiles += s.tiles
+		a.ageSum += s.ageSum
+		for i, n := range s.ageHist {
+			a.ageHist[i] += n
+		}
+		a.sampled += s.sampled
+		a.empty += s.empty
+		a.uniform += s.uniform
+	}
+	for lz, a := range ages {
+		buckets := make(map[float64]uint64, len(diskAgeBuckets))
+		var cum uint64
+		for i, ub := range diskAgeBuckets {
+			cum += a.ageHist[i]
+			buckets[ub] = cum
+		}
+		ch <- prometheus.MustNewConstHistogram(c.tile_age, uint64(a.tiles), a.ageSum, buckets, lz.layer, lz.zoom)
+
+		if a.sampled > 0 {
+			ch <- prometheus.MustNewConstMetric(c.sampled_tiles, prometheus.GaugeValue, a.empty, lz.layer, lz.zoom, tileEmpty)
+			ch <- prometheus.MustNewConstMetric(c.sampled_tiles, prometheus.GaugeValue, a.uniform, lz.layer, lz.zoom, tileUniform)
+			ch <- prometheus.MustNewConstMetric(c.sampled_tiles, prometheus.GaugeValue, a.sampled-a.empty-a.uniform, lz.layer, lz.zoom, tileContent)
+			ch <- prometheus.MustNewConstMetric(c.blank_ratio, prometheus.GaugeValue, (a.empty+a.uniform)/a.sampled, lz.layer, lz.zoom)
+		}
+	}
+	for layer, n := range expired {
+		ch <- prometheus.MustNewConstMetric(c.tiles_expired, prometheus.GaugeValue, n, layer)
+	}
+}
+
+func (c *diskScanCollector) run(ctx context.Context) {
+	for {
+		c.scan(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// roots expands the configured paths into a sorted, de-duplicated directory list.
+func (c *diskScanCollector) roots() []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, p := range c.paths {
+		switch p {
+		case "auto":
+			if c.homePaths != nil {
+				_, localStorage := c.homePaths()
+				add(localStorage)
+			}
+		case "config":
+			if cfg := c.config(); cfg != nil {
+				for _, b := range cfg.BlobStores.Items {
+					if enabledString(b.Enabled) == "true" {
+						add(b.BaseDirectory)
+					}
+				}
+			}
+		default:
+			add(p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// expiryFunc maps on-disk layer directory names to the layer's expiry.
+func (c *diskScanCollector) expiryFunc() func(layerDir string, zoom int) int {
+	cfg := c.config()
+	if cfg == nil {
+		return func(string, int) int { return 0 }
+	}
+	layers := map[string]gwcConfigLayer{}
+	for _, l := range cfg.Layers.Items {
+		layers[filteredLayerName(l.Name)] = l
+	}
+	return func(layerDir string, zoom int) int {
+		if l, ok := layers[layerDir]; ok {
+			return l.expireSeconds(zoom)
+		}
+		return 0
+	}
+}
+
+func (c *diskScanCollector) scan(ctx context.Context) {
+	start := time.Now()
+	expiry := c.expiryFunc()
+	tiles := map[diskTileKey]*diskTileStats{}
+	var blankSpent time.Duration
+
+	for _, root := range c.roots() {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return nil
+			}
+			layer, gridset, zoom, ok := parseDiskTilePath(rel)
+			if !ok {
+				return nil // metadata.properties and friends
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			k := diskTileKey{layer: layer, gridset: gridset, zoom: strconv.Itoa(zoom)}
+			s := tiles[k]
+			if s == nil {
+				s = &diskTileStats{ageHist: make([]uint64, len(diskAgeBuckets))}
+				tiles[k] = s
+			}
+			age := start.Sub(info.ModTime()).Seconds()
+			if age < 0 {
+				age = 0
+			}
+			s.tiles++
+			s.bytes += float64(info.Size())
+			s.ageSum += age
+			for i, ub := range diskAgeBuckets {
+				if age <= ub {
+					s.ageHist[i]++
+					break
+				}
+			}
+			if exp := expiry(layer, zoom); exp > 0 && age > float64(exp) {
+				s.expired++
+			}
+			if c.blankSampleRate > 0 && blankSpent < c.blankBudget && isRasterTile(p) && rand.Float64() < c.blankSampleRate {
+				t0 := time.Now()
+				class, err := classifyTileFile(p)
+				blankSpent += time.Since(t0)
+				if err == nil {
+					s.sampled++
+					switch class {
+					case tileEmpty:
+						s.empty++
+					case tileUniform:
+						s.uniform++
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("disk scan: walk failed root=%q err=%v", root, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.tiles = tiles
+	c.lastScan = time.Now()
+	c.duration = time.Since(start)
+	c.blankExhausted = blankSpent >= c.blankBudget
+	c.mu.Unlock()
+}
+
+// parseDiskTilePath splits a path relative to a file blob store root into
+// layer directory, grid set and zoom. ok is false for anything but a tile.
+func parseDiskTilePath(rel string) (layer, gridset string, zoom int, ok bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 4 || strings.HasSuffix(parts[3], ".tmp") {
+		return "", "", 0, false
+	}
+	m := diskZoomDirRe.FindStringSubmatch(parts[1])
+	if m == nil {
+		return "", "", 0, false
+	}
+	zoom, _ = strconv.Atoi(m[2])
+	return parts[0], m[1], zoom, true
+}
+
+// filteredLayerName mirrors how GWC turns a layer name into a directory name.
+func filteredLayerName(name string) string {
+	return strings.NewReplacer(":", "_", " ", "_", "/", "_", "\\", "_").Replace(name)
+}
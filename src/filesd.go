@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// fileSDGroup is a target group in Prometheus' file_sd format.
+type fileSDGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// fileSDSource reads targets from Prometheus file_sd files (JSON, or YAML for
+// .yml/.yaml). Patterns may be globs; the files are checked for changes on
+// every refresh and a file that no longer parses keeps its previous targets
+// and is read again on the next refresh.
+// Targets are host:port, or full home page URLs; the __scheme__ and
+// __metrics_path__ labels of a group override http and defaultPath, other
+// labels starting with __ are dropped.
+type fileSDSource struct {
+	patterns    []string
+	defaultPath string
+	interval    time.Duration
+
+	seen    map[string]string   // path -> size and modification time
+	targets map[string][]target // path -> targets of the last good read
+}
+
+func newFileSDSource(patterns []string, defaultPath string, interval time.Duration) *fileSDSource {
+	return &fileSDSource{
+		patterns:    patterns,
+		defaultPath: defaultPath,
+		interval:    interval,
+		seen:        map[string]string{},
+		targets:     map[string][]target{},
+	}
+}
+
+func (s *fileSDSource) run(ctx context.Context, update func([]target)) {
+	first := true
+	for {
+		if s.refresh() || first {
+			update(s.all())
+			first = false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// refresh rereads new and changed files and forgets removed ones. It reports
+// whether anything changed.
+func (s *fileSDSource) refresh() bool {
+	current := map[string]string{}
+	for _, pattern := range s.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Printf("file discovery: invalid pattern pattern=%q err=%v", pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			fi, err := os.Stat(path)
+			if err != nil || fi.IsDir() {
+				continue
+			}
+			current[path] = fmt.Sprintf("%d %d", fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+
+	changed := false
+	for path := range s.seen {
+		if _, ok := current[path]; !ok {
+			delete(s.seen, path)
+			delete(s.targets, path)
+			changed = true
+		}
+	}
+	for path, sig := range current {
+		if s.seen[path] == sig {
+			continue
+		}
+		targets, err := s.readFile(path)
+		if err != nil {
+			// Not marked as seen, so the next refresh tries again even if the
+			// file looks unchanged (e.g. it was still being written).
+			log.Printf("file discovery: read failed file=%q err=%v", path, err)
+			continue
+		}
+		s.seen[path] = sig
+		s.targets[path] = targets
+		changed = true
+	}
+	return changed
+}
+
+func (s *fileSDSource) all() []target {
+	var out []target
+	for _, ts := range s.targets {
+		out = append(out, ts...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].url < out[j].url })
+	return out
+}
+
+func (s *fileSDSource) readFile(path string) ([]target, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Both formats reject unknown fields, so a misspelt "labels" fails the
+	// file instead of silently dropping the labels.
+	var groups []fileSDGroup
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(b, &groups)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(&groups); err == nil && dec.More() {
+			err = errors.New("unexpected data after the target groups")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []target
+	for i, g := range groups {
+		scheme, path := "http", s.defaultPath
+		labels := map[string]string{}
+		for name, value := range g.Labels {
+			switch {
+			case name == "__scheme__":
+				scheme = value
+			case name == "__metrics_path__":
+				path = value
+			case strings.HasPrefix(name, "__"):
+			default:
+				labels[name] = value
+			}
+		}
+		if err := checkTargetLabels(labels); err != nil {
+			return nil, fmt.Errorf("group %d: %v", i, err)
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		for _, t := range g.Targets {
+			raw := t
+			if !strings.Contains(t, "://") {
+				raw = scheme + "://" + t + path
+			}
+			u, err := url.Parse(raw)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("group %d: invalid target %q", i, t)
+			}
+			out = append(out, target{url: raw, labels: labels})
+		}
+	}
+	return out, nil
+}
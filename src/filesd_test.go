@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSDReadFile(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                []target // nil with wantErr
+		wantErr             bool
+	}{
+		{
+			name: "json", file: "targets.json",
+			content: `[{"targets": ["gwc-1:8080", "gwc-2:8080"], "labels": {"site": "east"}}]`,
+			want: []target{
+				{url: "http://gwc-1:8080/geowebcache", labels: map[string]string{"site": "east"}},
+				{url: "http://gwc-2:8080/geowebcache", labels: map[string]string{"site": "east"}},
+			},
+		},
+		{
+			name: "yaml", file: "targets.yml",
+			content: "- targets: [\"gwc-1:8080\"]\n  labels:\n    site: west\n",
+			want:    []target{{url: "http://gwc-1:8080/geowebcache", labels: map[string]string{"site": "west"}}},
+		},
+		{
+			name: "scheme and path", file: "targets.yaml",
+			content: "- targets: [\"gwc-1:8443\"]\n  labels:\n    __scheme__: https\n    __metrics_path__: gwc/home\n    __meta_source: cmdb\n    site: east\n",
+			want:    []target{{url: "https://gwc-1:8443/gwc/home", labels: map[string]string{"site": "east"}}},
+		},
+		{
+			name: "full url", file: "targets.json",
+			content: `[{"targets": ["https://gwc.example.org/geowebcache/home"], "labels": {"__metrics_path__": "/ignored"}}]`,
+			want:    []target{{url: "https://gwc.example.org/geowebcache/home", labels: map[string]string{}}},
+		},
+		{
+			name: "no labels", file: "targets.json",
+			content: `[{"targets": ["gwc-1:8080"]}]`,
+			want:    []target{{url: "http://gwc-1:8080/geowebcache", labels: map[string]string{}}},
+		},
+		{name: "empty list", file: "targets.json", content: `[]`},
+		{name: "json unknown field", file: "targets.json", content: `[{"targets": ["gwc-1:8080"], "label": {"site": "east"}}]`, wantErr: true},
+		{name: "yaml unknown field", file: "targets.yml", content: "- targets: [\"gwc-1:8080\"]\n  label:\n    site: east\n", wantErr: true},
+		{name: "json trailing data", file: "targets.json", content: `[] []`, wantErr: true},
+		{name: "json syntax", file: "targets.json", content: `[{"targets": [`, wantErr: true},
+		{name: "reserved label", file: "targets.json", content: `[{"targets": ["gwc-1:8080"], "labels": {"target": "x"}}]`, wantErr: true},
+		{name: "invalid label name", file: "targets.json", content: `[{"targets": ["gwc-1:8080"], "labels": {"data-center": "x"}}]`, wantErr: true},
+		{name: "bad scheme", file: "targets.json", content: `[{"targets": ["gwc-1:8080"], "labels": {"__scheme__": "ftp"}}]`, wantErr: true},
+		{name: "no host", file: "targets.json", content: `[{"targets": ["http:///geowebcache"]}]`, wantErr: true},
+	}
+	s := newFileSDSource(nil, "/geowebcache", time.Minute)
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.readFile(path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileSDRefreshRetriesFailedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	write := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Now().Add(-time.Hour)
+	s := newFileSDSource([]string{path}, "/geowebcache", time.Minute)
+
+	write(`[{"targets": ["gwc-1:8080"]}]`, mtime)
+	if !s.refresh() || len(s.all()) != 1 {
+		t.Fatalf("first read: targets %v", s.all())
+	}
+
+	// A broken file keeps the previous targets.
+	write(`[{"targets": ["gwc-3:8080"]}}`, mtime.Add(time.Second))
+	if s.refresh() || len(s.all()) != 1 || s.all()[0].url != "http://gwc-1:8080/geowebcache" {
+		t.Fatalf("broken file: targets %v", s.all())
+	}
+
+	// The fix has the same size and modification time as the broken file
+	// (e.g. coarse timestamps); it is read because the failure was not
+	// recorded as seen.
+	write(`[{"targets": ["gwc-3:8080"]}]`, mtime.Add(time.Second))
+	if !s.refresh() || len(s.all()) != 1 || s.all()[0].url != "http://gwc-3:8080/geowebcache" {
+		t.Fatalf("fixed file: targets %v", s.all())
+	}
+	if s.refresh() {
+		t.Error("unchanged file reported as changed")
+	}
+
+	os.Remove(path)
+	if !s.refresh() || len(s.all()) != 0 {
+		t.Errorf("removed file: targets %v", s.all())
+	}
+}
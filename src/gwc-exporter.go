@@ -9,8 +9,11 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,6 +24,11 @@ type gwcCollector struct {
 	targetURL string
 	timeout   time.Duration
 
+	// Paths from the last home page, for collectors reading GWC's files.
+	mu           sync.Mutex
+	configFile   string
+	localStorage string
+
 	// Descriptors
 	up                                   *prometheus.Desc
 	started_seconds                      *prometheus.Desc
@@ -32,17 +40,28 @@ type gwcCollector struct {
 	bytes_total                          *prometheus.Desc
 	bandwidth_mbps                       *prometheus.Desc
 	cache_hit_ratio_percent              *prometheus.Desc
+	cache_hits_total                     *prometheus.Desc
+	cache_misses_total                   *prometheus.Desc
 	blank_kml_html_ratio_percent         *prometheus.Desc
 	peak_request_rate_per_second         *prometheus.Desc
 	peak_request_rate_timestamp_seconds  *prometheus.Desc
 	peak_bandwidth_mbps                  *prometheus.Desc
 	peak_bandwidth_timestamp_seconds     *prometheus.Desc
 	stats_delay_seconds                  *prometheus.Desc
-	interval_requests                    *prometheus.Desc // label: window
-	interval_rate_per_second             *prometheus.Desc // label: window
-	interval_bytes                       *prometheus.Desc // label: window
-	interval_bandwidth_mbps              *prometheus.Desc // label: window
+	target_clock_skew_seconds            *prometheus.Desc
+	target_clock_skew_resolution_seconds *prometheus.Desc
+	peak_timestamp_in_future             *prometheus.Desc // label: peak
+	interval_requests                    *prometheus.Desc // labels: window, window_seconds
+	interval_rate_per_second             *prometheus.Desc // labels: window, window_seconds
+	interval_bytes                       *prometheus.Desc // labels: window, window_seconds
+	interval_bandwidth_mbps              *prometheus.Desc // labels: window, window_seconds
+	interval_rates_per_second            *prometheus.Desc // summary over the windows
 	storage_info                         *prometheus.Desc // labels: config_file, local_storage
+	runtime_stats_enabled                *prometheus.Desc
+	runtime_stats_unchanged_scrapes      *prometheus.Desc
+	runtime_stats_stale                  *prometheus.Desc
+	stats_age_seconds                    *prometheus.Desc
+	stats_delay_exceeded                 *prometheus.Desc
 
 	// In-memory cache (optional)
 	memcache_present             *prometheus.Desc // 1 if section present, else 0
@@ -57,51 +76,147 @@ type gwcCollector struct {
 	memcache_total_size_bytes    *prometheus.Desc
 
 	version_build_info *prometheus.Desc // labels: version, build
+
+	// Base-unit names for -metrics.naming=v2
+	naming                              metricNaming
+	start_time_seconds                  *prometheus.Desc
+	bandwidth_bytes_per_second          *prometheus.Desc
+	cache_hit_ratio                     *prometheus.Desc
+	blank_kml_html_ratio                *prometheus.Desc
+	peak_bandwidth_bytes_per_second     *prometheus.Desc
+	interval_bandwidth_bytes_per_second *prometheus.Desc // labels: window, window_seconds
+	memcache_hits_total                 *prometheus.Desc
+	memcache_misses_total               *prometheus.Desc
+	memcache_hit_ratio                  *prometheus.Desc
+	memcache_miss_ratio                 *prometheus.Desc
+	memcache_occupation_ratio           *prometheus.Desc
+
+	hitMiss   hitMissTracker
+	freshness statsFreshness
+
+	// Peak events (new peak timestamps between scrapes)
+	peaks             *peakTracker
+	peak_events_total *prometheus.CounterVec // label: kind
+
+	// Parser diagnostics for page values that are shown but not understood
+	parse_errors_total *prometheus.CounterVec // label: field
+	lastParseErrors    map[string]string      // field -> last logged error, under mu
+
+	// Restart-resilient counters (optional, needs a state file)
+	state          *counterState
+	restarts_total *prometheus.Desc
+	cumulative     map[string]*prometheus.Desc // counter -> gwc_<counter>_cumulative_total
 }
 
-func newGwcCollector(targetURL string, timeout time.Duration) *gwcCollector {
+// intervalLabels keeps the window as shown on the page next to its length.
+var intervalLabels = []string{"window", "window_seconds"}
+
+// parsedFields are the home page values that go through the tolerant time
+// and duration parsers and are reported by gwc_parse_errors_total.
+var parsedFields = []string{"started", "uptime", "peak_request_rate_time", "peak_bandwidth_time", "interval_window"}
+
+// cumulativeCounters are the home page counters that reset with GWC.
+var cumulativeCounters = []string{"requests", "untiled_wms_requests", "bytes", "memcache_requests", "memcache_hit_count", "memcache_miss_count", "memcache_evicted_tiles"}
+
+func newGwcCollector(targetURL string, timeout time.Duration, state *counterState, naming metricNaming, staleScrapes int, peaks *peakTracker, constLabels prometheus.Labels) *gwcCollector {
 	const ns = "gwc"
-	return &gwcCollector{
+	c := &gwcCollector{
 		targetURL: targetURL,
 		timeout:   timeout,
+		state:     state,
+		naming:    naming,
+		freshness: statsFreshness{limit: staleScrapes},
+		peaks:     peaks,
+		hitMiss:   hitMissTracker{state: state, target: targetURL},
+
+		peak_events_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        ns + "_peak_events_total",
+			Help:        "Changes of a peak timestamp between scrapes, i.e. new peaks set by GWC, by kind.",
+			ConstLabels: constLabels,
+		}, []string{"kind"}),
+
+		parse_errors_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        ns + "_parse_errors_total",
+			Help:        "Home page values that were present but could not be parsed, by field.",
+			ConstLabels: constLabels,
+		}, []string{"field"}),
+		lastParseErrors: map[string]string{},
 
-		up:                                   prometheus.NewDesc(ns+"_up", "Was the last scrape of GWC status page successful.", nil, nil),
-		started_seconds:                      prometheus.NewDesc(ns+"_started_seconds", "Unix timestamp when GWC reports it started.", nil, nil),
-		uptime_seconds:                       prometheus.NewDesc(ns+"_uptime_seconds", "Reported uptime in seconds.", nil, nil),
-		requests_total:                       prometheus.NewDesc(ns+"_requests_total", "Total number of requests.", nil, nil),
-		requests_rate_per_second:             prometheus.NewDesc(ns+"_requests_rate_per_second", "Reported requests per second.", nil, nil),
-		untiled_wms_requests_total:           prometheus.NewDesc(ns+"_untiled_wms_requests_total", "Total number of untiled WMS requests.", nil, nil),
-		untiled_wms_requests_rate_per_second: prometheus.NewDesc(ns+"_untiled_wms_requests_rate_per_second", "Reported untiled WMS requests per second.", nil, nil),
-		bytes_total:                          prometheus.NewDesc(ns+"_bytes_total", "Total number of bytes served.", nil, nil),
-		bandwidth_mbps:                       prometheus.NewDesc(ns+"_bandwidth_mbps", "Reported bandwidth in Mbps.", nil, nil),
-		cache_hit_ratio_percent:              prometheus.NewDesc(ns+"_cache_hit_ratio_percent", "Cache hit ratio (percent of requests).", nil, nil),
-		blank_kml_html_ratio_percent:         prometheus.NewDesc(ns+"_blank_kml_html_ratio_percent", "Blank/KML/HTML percent of requests.", nil, nil),
-		peak_request_rate_per_second:         prometheus.NewDesc(ns+"_peak_request_rate_per_second", "Peak request rate (/s).", nil, nil),
-		peak_request_rate_timestamp_seconds:  prometheus.NewDesc(ns+"_peak_request_rate_timestamp_seconds", "Unix timestamp when peak request rate was observed.", nil, nil),
-		peak_bandwidth_mbps:                  prometheus.NewDesc(ns+"_peak_bandwidth_mbps", "Peak bandwidth in Mbps.", nil, nil),
-		peak_bandwidth_timestamp_seconds:     prometheus.NewDesc(ns+"_peak_bandwidth_timestamp_seconds", "Unix timestamp when peak bandwidth was observed.", nil, nil),
-		stats_delay_seconds:                  prometheus.NewDesc(ns+"_stats_delay_seconds", "Reported delay in runtime statistics.", nil, nil),
-
-		interval_requests:        prometheus.NewDesc(ns+"_interval_requests", "Requests in the reported time window.", []string{"window"}, nil),
-		interval_rate_per_second: prometheus.NewDesc(ns+"_interval_rate_per_second", "Requests per second in the reported time window.", []string{"window"}, nil),
-		interval_bytes:           prometheus.NewDesc(ns+"_interval_bytes", "Bytes in the reported time window.", []string{"window"}, nil),
-		interval_bandwidth_mbps:  prometheus.NewDesc(ns+"_interval_bandwidth_mbps", "Bandwidth Mbps in the reported time window.", []string{"window"}, nil),
-
-		storage_info: prometheus.NewDesc(ns+"_storage_info", "Storage paths as labels.", []string{"config_file", "local_storage"}, nil),
-
-		memcache_present:             prometheus.NewDesc(ns+"_memcache_present", "1 if 'In Memory Cache Statistics' section is present, else 0.", nil, nil),
-		memcache_requests_total:      prometheus.NewDesc(ns+"_memcache_requests_total", "In-memory cache total number of requests.", nil, nil),
-		memcache_hit_count_total:     prometheus.NewDesc(ns+"_memcache_hit_count_total", "In-memory cache hit count.", nil, nil),
-		memcache_miss_count_total:    prometheus.NewDesc(ns+"_memcache_miss_count_total", "In-memory cache miss count.", nil, nil),
-		memcache_hit_ratio_percent:   prometheus.NewDesc(ns+"_memcache_hit_ratio_percent", "In-memory cache hit ratio percent.", nil, nil),
-		memcache_miss_ratio_percent:  prometheus.NewDesc(ns+"_memcache_miss_ratio_percent", "In-memory cache miss ratio percent.", nil, nil),
-		memcache_evicted_tiles_total: prometheus.NewDesc(ns+"_memcache_evicted_tiles_total", "Total number of evicted tiles.", nil, nil),
-		memcache_occupation_percent:  prometheus.NewDesc(ns+"_memcache_occupation_percent", "Cache memory occupation percent.", nil, nil),
-		memcache_actual_size_bytes:   prometheus.NewDesc(ns+"_memcache_actual_size_bytes", "Cache actual size in bytes.", nil, nil),
-		memcache_total_size_bytes:    prometheus.NewDesc(ns+"_memcache_total_size_bytes", "Cache total size in bytes.", nil, nil),
-
-		version_build_info: prometheus.NewDesc(ns+"_build_info", "Version/build info as labels; value 1.", []string{"version", "build"}, nil),
+		up:                                   prometheus.NewDesc(ns+"_up", "Was the last scrape of GWC status page successful.", nil, constLabels),
+		started_seconds:                      prometheus.NewDesc(ns+"_started_seconds", "Unix timestamp when GWC reports it started.", nil, constLabels),
+		uptime_seconds:                       prometheus.NewDesc(ns+"_uptime_seconds", "Reported uptime in seconds.", nil, constLabels),
+		requests_total:                       prometheus.NewDesc(ns+"_requests_total", "Total number of requests.", nil, constLabels),
+		requests_rate_per_second:             prometheus.NewDesc(ns+"_requests_rate_per_second", "Reported requests per second.", nil, constLabels),
+		untiled_wms_requests_total:           prometheus.NewDesc(ns+"_untiled_wms_requests_total", "Total number of untiled WMS requests.", nil, constLabels),
+		untiled_wms_requests_rate_per_second: prometheus.NewDesc(ns+"_untiled_wms_requests_rate_per_second", "Reported untiled WMS requests per second.", nil, constLabels),
+		bytes_total:                          prometheus.NewDesc(ns+"_bytes_total", "Total number of bytes served.", nil, constLabels),
+		bandwidth_mbps:                       prometheus.NewDesc(ns+"_bandwidth_mbps", "Reported bandwidth in Mbps.", nil, constLabels),
+		cache_hit_ratio_percent:              prometheus.NewDesc(ns+"_cache_hit_ratio_percent", "Cache hit ratio (percent of requests).", nil, constLabels),
+		cache_hits_total:                     prometheus.NewDesc(ns+"_cache_hits_total", "Estimated cache hits (requests x cache hit ratio), kept rising across GWC restarts.", nil, constLabels),
+		cache_misses_total:                   prometheus.NewDesc(ns+"_cache_misses_total", "Estimated cache misses (new requests not counted as hits), kept rising across GWC restarts.", nil, constLabels),
+		blank_kml_html_ratio_percent:         prometheus.NewDesc(ns+"_blank_kml_html_ratio_percent", "Blank/KML/HTML percent of requests.", nil, constLabels),
+		peak_request_rate_per_second:         prometheus.NewDesc(ns+"_peak_request_rate_per_second", "Peak request rate (/s).", nil, constLabels),
+		peak_request_rate_timestamp_seconds:  prometheus.NewDesc(ns+"_peak_request_rate_timestamp_seconds", "Unix timestamp when peak request rate was observed.", nil, constLabels),
+		peak_bandwidth_mbps:                  prometheus.NewDesc(ns+"_peak_bandwidth_mbps", "Peak bandwidth in Mbps.", nil, constLabels),
+		peak_bandwidth_timestamp_seconds:     prometheus.NewDesc(ns+"_peak_bandwidth_timestamp_seconds", "Unix timestamp when peak bandwidth was observed.", nil, constLabels),
+		stats_delay_seconds:                  prometheus.NewDesc(ns+"_stats_delay_seconds", "Reported delay in runtime statistics.", nil, constLabels),
+		target_clock_skew_seconds:            prometheus.NewDesc(ns+"_target_clock_skew_seconds", "Started time plus uptime minus the exporter clock; positive when GWC is ahead.", nil, constLabels),
+		target_clock_skew_resolution_seconds: prometheus.NewDesc(ns+"_target_clock_skew_resolution_seconds", "Precision of the clock skew, given by the unit the uptime is shown in.", nil, constLabels),
+		peak_timestamp_in_future:             prometheus.NewDesc(ns+"_peak_timestamp_in_future", "1 if the peak timestamp lies in the future of the exporter clock, else 0.", []string{"peak"}, constLabels),
+
+		interval_requests:        prometheus.NewDesc(ns+"_interval_requests", "Requests in the reported time window.", intervalLabels, constLabels),
+		interval_rate_per_second: prometheus.NewDesc(ns+"_interval_rate_per_second", "Requests per second in the reported time window.", intervalLabels, constLabels),
+		interval_bytes:           prometheus.NewDesc(ns+"_interval_bytes", "Bytes in the reported time window.", intervalLabels, constLabels),
+		interval_bandwidth_mbps:  prometheus.NewDesc(ns+"_interval_bandwidth_mbps", "Bandwidth Mbps in the reported time window.", intervalLabels, constLabels),
+
+		interval_rates_per_second: prometheus.NewDesc(ns+"_interval_rates_per_second", "Requests per second across the reported windows: quantile 0 is the slowest window, 1 the busiest; count is the number of windows.", nil, constLabels),
+
+		storage_info: prometheus.NewDesc(ns+"_storage_info", "Storage paths as labels.", []string{"config_file", "local_storage"}, constLabels),
+
+		runtime_stats_enabled:           prometheus.NewDesc(ns+"_runtime_stats_enabled", "0 if the home page says runtime statistics are disabled, else 1.", nil, constLabels),
+		runtime_stats_unchanged_scrapes: prometheus.NewDesc(ns+"_runtime_stats_unchanged_scrapes", "Consecutive scrapes in which totals and interval rows did not change.", nil, constLabels),
+		runtime_stats_stale:             prometheus.NewDesc(ns+"_runtime_stats_stale", "1 if runtime statistics stopped updating while the interval rows still show traffic, else 0.", nil, constLabels),
+		stats_age_seconds:               prometheus.NewDesc(ns+"_stats_age_seconds", "Seconds by the exporter clock since totals or interval rows last changed.", nil, constLabels),
+		stats_delay_exceeded:            prometheus.NewDesc(ns+"_stats_delay_exceeded", "1 if the statistics did not change for longer than the reported stats delay plus the scrape interval while the interval rows show traffic, else 0.", nil, constLabels),
+
+		memcache_present:             prometheus.NewDesc(ns+"_memcache_present", "1 if 'In Memory Cache Statistics' section is present, else 0.", nil, constLabels),
+		memcache_requests_total:      prometheus.NewDesc(ns+"_memcache_requests_total", "In-memory cache total number of requests.", nil, constLabels),
+		memcache_hit_count_total:     prometheus.NewDesc(ns+"_memcache_hit_count_total", "In-memory cache hit count.", nil, constLabels),
+		memcache_miss_count_total:    prometheus.NewDesc(ns+"_memcache_miss_count_total", "In-memory cache miss count.", nil, constLabels),
+		memcache_hit_ratio_percent:   prometheus.NewDesc(ns+"_memcache_hit_ratio_percent", "In-memory cache hit ratio percent.", nil, constLabels),
+		memcache_miss_ratio_percent:  prometheus.NewDesc(ns+"_memcache_miss_ratio_percent", "In-memory cache miss ratio percent.", nil, constLabels),
+		memcache_evicted_tiles_total: prometheus.NewDesc(ns+"_memcache_evicted_tiles_total", "Total number of evicted tiles.", nil, constLabels),
+		memcache_occupation_percent:  prometheus.NewDesc(ns+"_memcache_occupation_percent", "Cache memory occupation percent.", nil, constLabels),
+		memcache_actual_size_bytes:   prometheus.NewDesc(ns+"_memcache_actual_size_bytes", "Cache actual size in bytes.", nil, constLabels),
+		memcache_total_size_bytes:    prometheus.NewDesc(ns+"_memcache_total_size_bytes", "Cache total size in bytes.", nil, constLabels),
+
+		version_build_info: prometheus.NewDesc(ns+"_build_info", "Version/build info as labels; value 1.", []string{"version", "build"}, constLabels),
+
+		start_time_seconds:                  prometheus.NewDesc(ns+"_start_time_seconds", "Unix time GWC reports it started.", nil, constLabels),
+		bandwidth_bytes_per_second:          prometheus.NewDesc(ns+"_bandwidth_bytes_per_second", "Reported average bandwidth in bytes per second.", nil, constLabels),
+		cache_hit_ratio:                     prometheus.NewDesc(ns+"_cache_hit_ratio", "Cache hit ratio of all requests (0-1).", nil, constLabels),
+		blank_kml_html_ratio:                prometheus.NewDesc(ns+"_blank_kml_html_ratio", "Blank/KML/HTML share of all requests (0-1).", nil, constLabels),
+		peak_bandwidth_bytes_per_second:     prometheus.NewDesc(ns+"_peak_bandwidth_bytes_per_second", "Peak bandwidth in bytes per second.", nil, constLabels),
+		interval_bandwidth_bytes_per_second: prometheus.NewDesc(ns+"_interval_bandwidth_bytes_per_second", "Bandwidth in bytes per second over the window.", intervalLabels, constLabels),
+		memcache_hits_total:                 prometheus.NewDesc(ns+"_memcache_hits_total", "In-memory cache hits.", nil, constLabels),
+		memcache_misses_total:               prometheus.NewDesc(ns+"_memcache_misses_total", "In-memory cache misses.", nil, constLabels),
+		memcache_hit_ratio:                  prometheus.NewDesc(ns+"_memcache_hit_ratio", "In-memory cache hit ratio (0-1).", nil, constLabels),
+		memcache_miss_ratio:                 prometheus.NewDesc(ns+"_memcache_miss_ratio", "In-memory cache miss ratio (0-1).", nil, constLabels),
+		memcache_occupation_ratio:           prometheus.NewDesc(ns+"_memcache_occupation_ratio", "In-memory cache memory occupation (0-1).", nil, constLabels),
+
+		restarts_total: prometheus.NewDesc(ns+"_restarts_total", "GWC restarts seen by the exporter (start time changed or a counter went down).", nil, constLabels),
+		cumulative:     map[string]*prometheus.Desc{},
+	}
+	for _, name := range cumulativeCounters {
+		c.cumulative[name] = prometheus.NewDesc(ns+"_"+name+"_cumulative_total", "gwc_"+name+"_total kept rising across GWC restarts.", nil, constLabels)
+	}
+	for _, field := range parsedFields {
+		c.parse_errors_total.WithLabelValues(field)
+	}
+	for _, kind := range []string{"request_rate", "bandwidth"} {
+		c.peak_events_total.WithLabelValues(kind)
 	}
+	return c
 }
 
 func (c *gwcCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -115,17 +230,28 @@ func (c *gwcCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.bytes_total
 	ch <- c.bandwidth_mbps
 	ch <- c.cache_hit_ratio_percent
+	ch <- c.cache_hits_total
+	ch <- c.cache_misses_total
 	ch <- c.blank_kml_html_ratio_percent
 	ch <- c.peak_request_rate_per_second
 	ch <- c.peak_request_rate_timestamp_seconds
 	ch <- c.peak_bandwidth_mbps
 	ch <- c.peak_bandwidth_timestamp_seconds
 	ch <- c.stats_delay_seconds
+	ch <- c.target_clock_skew_seconds
+	ch <- c.target_clock_skew_resolution_seconds
+	ch <- c.peak_timestamp_in_future
 	ch <- c.interval_requests
 	ch <- c.interval_rate_per_second
 	ch <- c.interval_bytes
 	ch <- c.interval_bandwidth_mbps
+	ch <- c.interval_rates_per_second
 	ch <- c.storage_info
+	ch <- c.runtime_stats_enabled
+	ch <- c.runtime_stats_unchanged_scrapes
+	ch <- c.runtime_stats_stale
+	ch <- c.stats_age_seconds
+	ch <- c.stats_delay_exceeded
 
 	// memcache
 	ch <- c.memcache_present
@@ -140,259 +266,632 @@ func (c *gwcCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.memcache_total_size_bytes
 
 	ch <- c.version_build_info
+
+	if c.naming.v2 {
+		ch <- c.start_time_seconds
+		ch <- c.bandwidth_bytes_per_second
+		ch <- c.cache_hit_ratio
+		ch <- c.blank_kml_html_ratio
+		ch <- c.peak_bandwidth_bytes_per_second
+		ch <- c.interval_bandwidth_bytes_per_second
+		ch <- c.memcache_hits_total
+		ch <- c.memcache_misses_total
+		ch <- c.memcache_hit_ratio
+		ch <- c.memcache_miss_ratio
+		ch <- c.memcache_occupation_ratio
+	}
+
+	if c.state != nil {
+		ch <- c.restarts_total
+		for _, name := range cumulativeCounters {
+			ch <- c.cumulative[name]
+		}
+	}
+
+	c.parse_errors_total.Describe(ch)
+	c.peak_events_total.Describe(ch)
 }
 
 func (c *gwcCollector) Collect(ch chan<- prometheus.Metric) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	st, err := c.scrape()
+	c.collectStats(ch, st, err)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.targetURL, nil)
+// scrape fetches and parses the home page.
+func (c *gwcCollector) scrape() (homeStats, error) {
+	html, err := c.fetch()
 	if err != nil {
-		log.Printf("gwc scrape: cannot create request target=%q err=%v", c.targetURL, err)
-		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
-		return
+		return homeStats{}, err
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("gwc scrape: request failed target=%q err=%v", c.targetURL, err)
-		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
-		return
-	}
-	defer resp.Body.Close()
+	return parseHomePage(html), nil
+}
 
-	if resp.StatusCode != 200 {
-		log.Printf("gwc scrape: non-200 response target=%q status=%d", c.targetURL, resp.StatusCode)
-		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
-		return
-	}
+// collectStats emits the metrics of one scrape; err is the scrape error.
+// Cluster mode scrapes all nodes first and then calls this per node. With a
+// state file it returns the restart-corrected counters, else nil.
+func (c *gwcCollector) collectStats(ch chan<- prometheus.Metric, st homeStats, err error) map[string]float64 {
+	defer c.parse_errors_total.Collect(ch)
+	defer c.peak_events_total.Collect(ch)
 
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("gwc scrape: cannot read response body target=%q err=%v", c.targetURL, err)
+		log.Printf("gwc scrape: %v target=%q", err, c.targetURL)
 		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
-		return
+		return nil
 	}
-	html := string(body)
+	c.recordParseErrors(st.parseErrors)
+	v1, v2 := c.naming.legacyNames(), c.naming.v2
 
-	// Normalize
-	html = strings.ReplaceAll(html, "&nbsp;", " ")
-	html = regexp.MustCompile(`\s+`).ReplaceAllString(html, " ")
+	// counter attaches the GWC start time as created timestamp in v2 mode.
+	counter := func(desc *prometheus.Desc, v float64) prometheus.Metric {
+		if v2 && st.started > 0 {
+			return prometheus.MustNewConstMetricWithCreatedTimestamp(desc, prometheus.CounterValue, v, time.Unix(st.started, 0))
+		}
+		return prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+	}
 
 	// base liveness
 	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
 
 	// Version/build
-	if ver, build := parseVersionBuild(html); ver != "" || build != "" {
-		ch <- prometheus.MustNewConstMetric(c.version_build_info, prometheus.GaugeValue, 1, ver, build)
+	if st.version != "" || st.build != "" {
+		ch <- prometheus.MustNewConstMetric(c.version_build_info, prometheus.GaugeValue, 1, st.version, st.build)
 	}
 
 	// Started + uptime
-	if ts := parseStartedUnix(html); ts > 0 {
-		ch <- prometheus.MustNewConstMetric(c.started_seconds, prometheus.GaugeValue, float64(ts))
+	if st.started > 0 && v1 {
+		ch <- prometheus.MustNewConstMetric(c.started_seconds, prometheus.GaugeValue, float64(st.started))
 	}
-	if up := parseUptimeSeconds(html); up > 0 {
-		ch <- prometheus.MustNewConstMetric(c.uptime_seconds, prometheus.GaugeValue, float64(up))
+	if st.started > 0 && v2 {
+		ch <- prometheus.MustNewConstMetric(c.start_time_seconds, prometheus.GaugeValue, float64(st.started))
+	}
+	if st.uptime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.uptime_seconds, prometheus.GaugeValue, float64(st.uptime))
 	}
 
 	// Totals + rates
-	if v := parseFirstNumber(html, `Total number of requests:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.requests_total, prometheus.CounterValue, float64(v))
+	if st.requests >= 0 {
+		ch <- counter(c.requests_total, st.requests)
+	}
+	if st.requestRate >= 0 {
+		ch <- prometheus.MustNewConstMetric(c.requests_rate_per_second, prometheus.GaugeValue, st.requestRate)
+	}
+	if st.untiledRequests >= 0 {
+		ch <- counter(c.untiled_wms_requests_total, st.untiledRequests)
+	}
+	if st.untiledRate >= 0 {
+		ch <- prometheus.MustNewConstMetric(c.untiled_wms_requests_rate_per_second, prometheus.GaugeValue, st.untiledRate)
+	}
+	if st.bytes >= 0 {
+		ch <- counter(c.bytes_total, st.bytes)
 	}
-	//if v := parseFirstFloat(html, `Total number of requests:.*\(([0-9.]+)\/s`); v >= 0 {
-	//if v := parseFirstFloat(html, `Total number of requests:\s*[0-9,]+\s*\(([0-9.]+)\s*/s\s*\)`); v >= 0 {
-	//if v := parseFirstFloat(html, `Total number of requests:\s*[0-9,]+\s*\(\s*([0-9.]+)\s*/s\s*\)`); v >= 0 {
-	if v := parseFirstFloat(html, `Total number of requests:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*/s\s*\)\s*</td>`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.requests_rate_per_second, prometheus.GaugeValue, v)
+	if st.bandwidthMbps >= 0 && v1 {
+		ch <- prometheus.MustNewConstMetric(c.bandwidth_mbps, prometheus.GaugeValue, st.bandwidthMbps)
 	}
-	//if v := parseFirstNumber(html, `Total number of untiled WMS requests:\s*([0-9]+)`); v >= 0 {
-	if v := parseFirstNumber(html, `Total number of untiled WMS requests:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.untiled_wms_requests_total, prometheus.CounterValue, float64(v))
+	if st.bandwidthMbps >= 0 && v2 {
+		ch <- prometheus.MustNewConstMetric(c.bandwidth_bytes_per_second, prometheus.GaugeValue, mbpsToBytes(st.bandwidthMbps))
 	}
-	if v := parseFirstFloat(html, `Total number of untiled WMS requests:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*/s\s*\)\s*</td>`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.untiled_wms_requests_rate_per_second, prometheus.GaugeValue, v)
+	if st.cacheHitPercent >= 0 && v1 {
+		ch <- prometheus.MustNewConstMetric(c.cache_hit_ratio_percent, prometheus.GaugeValue, st.cacheHitPercent)
 	}
-	if v := parseFirstNumber(html, `Total number of bytes:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.bytes_total, prometheus.CounterValue, float64(v))
+	if st.cacheHitPercent >= 0 && v2 {
+		ch <- prometheus.MustNewConstMetric(c.cache_hit_ratio, prometheus.GaugeValue, st.cacheHitPercent/100)
 	}
-	if v := parseFirstFloat(html, `Total number of bytes:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*mbps`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.bandwidth_mbps, prometheus.GaugeValue, v)
+	if st.requests >= 0 && st.cacheHitPercent >= 0 {
+		hits, misses := c.hitMiss.observe(st.started, st.requests, st.cacheHitPercent)
+		ch <- prometheus.MustNewConstMetric(c.cache_hits_total, prometheus.CounterValue, hits)
+		ch <- prometheus.MustNewConstMetric(c.cache_misses_total, prometheus.CounterValue, misses)
 	}
-	//if v := parseFirstFloat(html, `Cache hit ratio:\s*([0-9.]+)% of requests`); v >= 0 {
-	if v := parseFirstFloat(html, `Cache hit ratio:\s*</th>\s*<td[^>]*>\s*([0-9.]+)% of requests`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.cache_hit_ratio_percent, prometheus.GaugeValue, v)
+	if st.blankPercent >= 0 && v1 {
+		ch <- prometheus.MustNewConstMetric(c.blank_kml_html_ratio_percent, prometheus.GaugeValue, st.blankPercent)
 	}
-	if v := parseFirstFloat(html, `Blank/KML/HTML:\s*</th>\s*<td[^>]*>\s*([0-9.]+)% of requests`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.blank_kml_html_ratio_percent, prometheus.GaugeValue, v)
+	if st.blankPercent >= 0 && v2 {
+		ch <- prometheus.MustNewConstMetric(c.blank_kml_html_ratio, prometheus.GaugeValue, st.blankPercent/100)
 	}
-	if v := parseFirstFloat(html, `Peak request rate:\s*</th>\s*<td[^>]*>\s*([0-9.]+)\s*/s`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.peak_request_rate_per_second, prometheus.GaugeValue, v)
+	if st.peakRate >= 0 {
+		ch <- prometheus.MustNewConstMetric(c.peak_request_rate_per_second, prometheus.GaugeValue, st.peakRate)
 	}
-	if ts := parseRFC1123InParens(html, `Peak request rate:\s*</th>\s*<td[^>]*>\s*[0-9.]+\s*/s\s*\(([^)]+)\)`); ts > 0 {
-		ch <- prometheus.MustNewConstMetric(c.peak_request_rate_timestamp_seconds, prometheus.GaugeValue, float64(ts))
+	if st.peakRateTime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.peak_request_rate_timestamp_seconds, prometheus.GaugeValue, float64(st.peakRateTime))
 	}
-	if v := parseFirstFloat(html, `Peak bandwidth:\s*</th>\s*<td[^>]*>\s*([0-9.]+)\s*mbps`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.peak_bandwidth_mbps, prometheus.GaugeValue, v)
+	if st.peakBandwidthMbps >= 0 && v1 {
+		ch <- prometheus.MustNewConstMetric(c.peak_bandwidth_mbps, prometheus.GaugeValue, st.peakBandwidthMbps)
 	}
-	if ts := parseRFC1123InParens(html, `Peak bandwidth:\s*</th>\s*<td[^>]*>\s*[0-9.]+\s*mbps\s*\(([^)]+)\)`); ts > 0 {
-		ch <- prometheus.MustNewConstMetric(c.peak_bandwidth_timestamp_seconds, prometheus.GaugeValue, float64(ts))
+	if st.peakBandwidthMbps >= 0 && v2 {
+		ch <- prometheus.MustNewConstMetric(c.peak_bandwidth_bytes_per_second, prometheus.GaugeValue, mbpsToBytes(st.peakBandwidthMbps))
 	}
-	if v := parseFirstFloat(html, `All figures are ([0-9.]+)\s*second\(s\) delayed`); v >= 0 {
-		ch <- prometheus.MustNewConstMetric(c.stats_delay_seconds, prometheus.GaugeValue, v)
+	if st.peakBandwidthTime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.peak_bandwidth_timestamp_seconds, prometheus.GaugeValue, float64(st.peakBandwidthTime))
+	}
+	if st.statsDelay >= 0 {
+		ch <- prometheus.MustNewConstMetric(c.stats_delay_seconds, prometheus.GaugeValue, st.statsDelay)
+	}
+
+	// Clock sanity
+	now := time.Now()
+	if skew, ok := clockSkew(st, now); ok {
+		ch <- prometheus.MustNewConstMetric(c.target_clock_skew_seconds, prometheus.GaugeValue, skew)
+		ch <- prometheus.MustNewConstMetric(c.target_clock_skew_resolution_seconds, prometheus.GaugeValue, float64(st.uptimeResolution))
+	}
+	if st.peakRateTime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.peak_timestamp_in_future, prometheus.GaugeValue, inFuture(st.peakRateTime, now), "request_rate")
+	}
+	if st.peakBandwidthTime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.peak_timestamp_in_future, prometheus.GaugeValue, inFuture(st.peakBandwidthTime, now), "bandwidth")
+	}
+
+	// Peak events
+	if c.peaks.observe(c.targetURL, "request_rate", "requests_per_second", st.peakRate, st.peakRateTime, now) {
+		c.peak_events_total.WithLabelValues("request_rate").Inc()
+	}
+	if c.peaks.observe(c.targetURL, "bandwidth", "mbps", st.peakBandwidthMbps, st.peakBandwidthTime, now) {
+		c.peak_events_total.WithLabelValues("bandwidth").Inc()
 	}
 
 	// Interval rows
-	intervals := []string{"3 seconds", "15 seconds", "60 seconds"}
-	for _, win := range intervals {
-		re := regexp.MustCompile(fmt.Sprintf(`<tr>\s*<td>\s*%s\s*</td>\s*<td[^>]*>\s*([0-9,]+)\s*</td>\s*<td[^>]*>\s*([0-9.]+)\s*/s\s*</td>\s*<td[^>]*>\s*([0-9,]+)\s*</td>\s*<td[^>]*>\s*([0-9.]+)\s*mbps`, regexp.QuoteMeta(win)))
-		if m := re.FindStringSubmatch(html); len(m) == 5 {
-			reqs := toInt(m[1])
-			rate := toFloat(m[2])
-			bytes := toInt(m[3])
-			mbps := toFloat(m[4])
-			if reqs >= 0 {
-				ch <- prometheus.MustNewConstMetric(c.interval_requests, prometheus.GaugeValue, float64(reqs), win)
-			}
-			if rate >= 0 {
-				ch <- prometheus.MustNewConstMetric(c.interval_rate_per_second, prometheus.GaugeValue, rate, win)
-			}
-			if bytes >= 0 {
-				ch <- prometheus.MustNewConstMetric(c.interval_bytes, prometheus.GaugeValue, float64(bytes), win)
-			}
-			if mbps >= 0 {
-				ch <- prometheus.MustNewConstMetric(c.interval_bandwidth_mbps, prometheus.GaugeValue, mbps, win)
-			}
+	for _, iv := range st.intervals {
+		seconds := strconv.FormatInt(iv.seconds, 10)
+		if iv.requests >= 0 {
+			ch <- prometheus.MustNewConstMetric(c.interval_requests, prometheus.GaugeValue, iv.requests, iv.window, seconds)
+		}
+		if iv.rate >= 0 {
+			ch <- prometheus.MustNewConstMetric(c.interval_rate_per_second, prometheus.GaugeValue, iv.rate, iv.window, seconds)
+		}
+		if iv.bytes >= 0 {
+			ch <- prometheus.MustNewConstMetric(c.interval_bytes, prometheus.GaugeValue, iv.bytes, iv.window, seconds)
+		}
+		if iv.mbps >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.interval_bandwidth_mbps, prometheus.GaugeValue, iv.mbps, iv.window, seconds)
+		}
+		if iv.mbps >= 0 && v2 {
+			ch <- prometheus.MustNewConstMetric(c.interval_bandwidth_bytes_per_second, prometheus.GaugeValue, mbpsToBytes(iv.mbps), iv.window, seconds)
+		}
+	}
+	if len(st.intervals) > 0 {
+		count, sum, quantiles := intervalRateSummary(st.intervals)
+		ch <- prometheus.MustNewConstSummary(c.interval_rates_per_second, count, sum, quantiles)
+	}
+
+	// Runtime statistics health
+	if st.statsDisabled {
+		ch <- prometheus.MustNewConstMetric(c.runtime_stats_enabled, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(c.runtime_stats_stale, prometheus.GaugeValue, 0)
+	} else {
+		unchanged, stale := c.freshness.observe(st, now)
+		staleValue := 0.0
+		if stale {
+			staleValue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.runtime_stats_enabled, prometheus.GaugeValue, 1)
+		ch <- prometheus.MustNewConstMetric(c.runtime_stats_unchanged_scrapes, prometheus.GaugeValue, float64(unchanged))
+		ch <- prometheus.MustNewConstMetric(c.runtime_stats_stale, prometheus.GaugeValue, staleValue)
+		age, spacing := c.freshness.age()
+		ch <- prometheus.MustNewConstMetric(c.stats_age_seconds, prometheus.GaugeValue, age.Seconds())
+		if st.statsDelay >= 0 && spacing > 0 {
+			ch <- prometheus.MustNewConstMetric(c.stats_delay_exceeded, prometheus.GaugeValue, statsDelayExceeded(st, age, spacing))
 		}
 	}
 
 	// Storage info
-	configFile := parseFirstString(html, `Config file:\s*</th>\s*<td[^>]*>\s*<tt>([^<]+)`)
-	localStorage := parseFirstString(html, `Local Storage:\s*</th>\s*<td[^>]*>\s*<tt>([^<]+)`)
-	if configFile != "" || localStorage != "" {
-		ch <- prometheus.MustNewConstMetric(c.storage_info, prometheus.GaugeValue, 1, configFile, localStorage)
+	if st.configFile != "" || st.localStorage != "" {
+		c.mu.Lock()
+		c.configFile, c.localStorage = st.configFile, st.localStorage
+		c.mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(c.storage_info, prometheus.GaugeValue, 1, st.configFile, st.localStorage)
 	}
 
 	// In-memory cache — only emit when section exists
-	if strings.Contains(html, "In Memory Cache Statistics") {
+	if mc := st.memcache; mc != nil {
 		ch <- prometheus.MustNewConstMetric(c.memcache_present, prometheus.GaugeValue, 1)
-
-		// Values are in the next <td> after the label
-		if v := parseFirstNumber(html, `Total number of requests:</td><td[^>]*>\s*([0-9,]+)`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_requests_total, prometheus.CounterValue, float64(v))
+		if mc.requests >= 0 {
+			ch <- counter(c.memcache_requests_total, mc.requests)
+		}
+		if mc.hits >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_hit_count_total, prometheus.CounterValue, mc.hits)
 		}
-		if v := parseFirstNumber(html, `Internal Cache hit count:</td><td[^>]*>\s*([0-9,]+)`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_hit_count_total, prometheus.CounterValue, float64(v))
+		if mc.hits >= 0 && v2 {
+			ch <- counter(c.memcache_hits_total, mc.hits)
 		}
-		if v := parseFirstNumber(html, `Internal Cache miss count:</td><td[^>]*>\s*([0-9,]+)`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_miss_count_total, prometheus.CounterValue, float64(v))
+		if mc.misses >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_miss_count_total, prometheus.CounterValue, mc.misses)
 		}
-		if v := parseFirstFloat(html, `Internal Cache hit ratio:</td><td[^>]*>\s*([0-9.]+)\s*%`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio_percent, prometheus.GaugeValue, v)
+		if mc.misses >= 0 && v2 {
+			ch <- counter(c.memcache_misses_total, mc.misses)
 		}
-		if v := parseFirstFloat(html, `Internal Cache miss ratio:</td><td[^>]*>\s*([0-9.]+)\s*%`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_miss_ratio_percent, prometheus.GaugeValue, v)
+		if mc.hitPercent >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio_percent, prometheus.GaugeValue, mc.hitPercent)
 		}
-		if v := parseFirstNumber(html, `Total number of evicted tiles:</td><td[^>]*>\s*([0-9,]+)`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_evicted_tiles_total, prometheus.CounterValue, float64(v))
+		if mc.hitPercent >= 0 && v2 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio, prometheus.GaugeValue, mc.hitPercent/100)
 		}
-		if v := parseFirstFloat(html, `Cache Memory occupation:</td><td[^>]*>\s*([0-9.]+)\s*%`); v >= 0 {
-			ch <- prometheus.MustNewConstMetric(c.memcache_occupation_percent, prometheus.GaugeValue, v)
+		if mc.missPercent >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_miss_ratio_percent, prometheus.GaugeValue, mc.missPercent)
 		}
-		if act, tot := parseSizesMB(html); act >= 0 && tot >= 0 {
+		if mc.missPercent >= 0 && v2 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_miss_ratio, prometheus.GaugeValue, mc.missPercent/100)
+		}
+		if mc.evicted >= 0 {
+			ch <- counter(c.memcache_evicted_tiles_total, mc.evicted)
+		}
+		if mc.occupationPercent >= 0 && v1 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_occupation_percent, prometheus.GaugeValue, mc.occupationPercent)
+		}
+		if mc.occupationPercent >= 0 && v2 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_occupation_ratio, prometheus.GaugeValue, mc.occupationPercent/100)
+		}
+		if mc.actualMB >= 0 && mc.totalMB >= 0 {
 			// MB as decimal 1e6
-			ch <- prometheus.MustNewConstMetric(c.memcache_actual_size_bytes, prometheus.GaugeValue, act*1e6)
-			ch <- prometheus.MustNewConstMetric(c.memcache_total_size_bytes, prometheus.GaugeValue, tot*1e6)
+			ch <- prometheus.MustNewConstMetric(c.memcache_actual_size_bytes, prometheus.GaugeValue, mc.actualMB*1e6)
+			ch <- prometheus.MustNewConstMetric(c.memcache_total_size_bytes, prometheus.GaugeValue, mc.totalMB*1e6)
 		}
 	} else {
 		ch <- prometheus.MustNewConstMetric(c.memcache_present, prometheus.GaugeValue, 0)
-		// Keep a stable metric set when memcache is disabled.
-		ch <- prometheus.MustNewConstMetric(c.memcache_requests_total, prometheus.CounterValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_hit_count_total, prometheus.CounterValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_miss_count_total, prometheus.CounterValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio_percent, prometheus.GaugeValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_miss_ratio_percent, prometheus.GaugeValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_evicted_tiles_total, prometheus.CounterValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_occupation_percent, prometheus.GaugeValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_actual_size_bytes, prometheus.GaugeValue, 0)
-		ch <- prometheus.MustNewConstMetric(c.memcache_total_size_bytes, prometheus.GaugeValue, 0)
+		// v1 keeps a stable metric set when memcache is disabled; v2 drops the
+		// series, since counters of a cache that does not exist are misleading.
+		// The legacy names of v2 follow v2, so all memcache series come and go
+		// together.
+		if !v2 {
+			ch <- prometheus.MustNewConstMetric(c.memcache_requests_total, prometheus.CounterValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_evicted_tiles_total, prometheus.CounterValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_actual_size_bytes, prometheus.GaugeValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_total_size_bytes, prometheus.GaugeValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_hit_count_total, prometheus.CounterValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_miss_count_total, prometheus.CounterValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_hit_ratio_percent, prometheus.GaugeValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_miss_ratio_percent, prometheus.GaugeValue, 0)
+			ch <- prometheus.MustNewConstMetric(c.memcache_occupation_percent, prometheus.GaugeValue, 0)
+		}
 	}
+
+	if c.state != nil {
+		return c.collectCumulative(ch, st)
+	}
+	return nil
 }
 
-func parseVersionBuild(html string) (string, string) {
-	re := regexp.MustCompile(`Welcome to GeoWebCache version ([^,]+), build ([^<]+)`)
-	m := re.FindStringSubmatch(html)
-	if len(m) == 3 {
-		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+// collectCumulative emits the restart-corrected counters and returns them.
+func (c *gwcCollector) collectCumulative(ch chan<- prometheus.Metric, st homeStats) map[string]float64 {
+	cumulative, restarts, err := c.state.observe(c.targetURL, st.started, counterValues(st))
+	if err != nil {
+		log.Printf("gwc scrape: cannot write state file path=%q err=%v", c.state.path, err)
 	}
-	return "", ""
+	ch <- prometheus.MustNewConstMetric(c.restarts_total, prometheus.CounterValue, restarts)
+	for _, name := range cumulativeCounters {
+		if v, ok := cumulative[name]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cumulative[name], prometheus.CounterValue, v)
+		}
+	}
+	return cumulative
 }
 
-/*
-func parseStartedUnix(html string) int64 {
-	re := regexp.MustCompile(`Started:\s*([A-Za-z]{3}, [0-9]{2} [A-Za-z]{3} [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2} GMT)`)
-	m := re.FindStringSubmatch(html)
-	if len(m) != 2 {
-		return 0
+// counterValues are the lifetime counters of a home page by their
+// cumulativeCounters name; counters missing from the page are left out.
+func counterValues(st homeStats) map[string]float64 {
+	values := map[string]float64{}
+	add := func(name string, v float64) {
+		if v >= 0 {
+			values[name] = v
+		}
 	}
-	t, err := time.Parse(time.RFC1123, m[1])
+	add("requests", st.requests)
+	add("untiled_wms_requests", st.untiledRequests)
+	add("bytes", st.bytes)
+	if mc := st.memcache; mc != nil {
+		add("memcache_requests", mc.requests)
+		add("memcache_hit_count", mc.hits)
+		add("memcache_miss_count", mc.misses)
+		add("memcache_evicted_tiles", mc.evicted)
+	}
+	return values
+}
+
+// metricNaming selects the home page metric names. v1 is the original set;
+// v2 uses base units (bytes per second, 0-1 ratios), attaches the GWC start
+// time as created timestamp to counters and skips memcache series when there
+// is no memcache. legacy keeps the v1 names next to v2 while dashboards move.
+type metricNaming struct {
+	v2     bool
+	legacy bool
+}
+
+func parseMetricNaming(naming string, legacy bool) (metricNaming, error) {
+	switch naming {
+	case "v1":
+		return metricNaming{}, nil
+	case "v2":
+		return metricNaming{v2: true, legacy: legacy}, nil
+	}
+	return metricNaming{}, fmt.Errorf("unknown metrics naming %q (want v1 or v2)", naming)
+}
+
+// checkClusterFlags rejects settings that rely on the single home page of
+// -target.url when cluster mode replaced it: "auto" paths would never be
+// resolved, and the WMTS, service and REST collectors would silently probe
+// the default URL unless -target.url was set on purpose (e.g. to the load
+// balancer in front of the nodes).
+func checkClusterFlags(configPath, storagePath string, diskPaths []string, wmts bool, probes []string, s3Bucket string) error {
+	var auto []string
+	if configPath == "auto" {
+		auto = append(auto, "-gwc-config.path")
+	}
+	if storagePath == "auto" {
+		auto = append(auto, "-storage.path")
+	}
+	if slices.Contains(diskPaths, "auto") {
+		auto = append(auto, "-disk.path")
+	}
+	if len(auto) > 0 {
+		return fmt.Errorf("%s auto needs the home page of -target.url; set explicit paths", strings.Join(auto, ", "))
+	}
+
+	targetSet := false
+	flag.Visit(func(f *flag.Flag) { targetSet = targetSet || f.Name == "target.url" })
+	if _, ok := os.LookupEnv("GWC_TARGET_URL"); ok {
+		targetSet = true
+	}
+	var probing []string
+	if wmts {
+		probing = append(probing, "-wmts.capabilities")
+	}
+	if len(probes) > 0 {
+		probing = append(probing, "-service.probe")
+	}
+	if s3Bucket == "rest" {
+		probing = append(probing, "-s3.bucket rest")
+	}
+	if len(probing) > 0 && !targetSet {
+		return fmt.Errorf("%s use -target.url, not the cluster nodes; set -target.url explicitly (e.g. to the load balancer) or disable them", strings.Join(probing, ", "))
+	}
+	return nil
+}
+
+// legacyNames reports whether v1-only names are emitted.
+func (n metricNaming) legacyNames() bool { return !n.v2 || n.legacy }
+
+// mbpsToBytes converts GWC's megabits per second to bytes per second.
+func mbpsToBytes(mbps float64) float64 { return mbps * 1e6 / 8 }
+
+// fetch GETs the home page and returns it with whitespace and &nbsp; normalized.
+func (c *gwcCollector) fetch() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.targetURL, nil)
 	if err != nil {
-		return 0
+		return "", fmt.Errorf("cannot create request: %w", err)
 	}
-	return t.Unix()
-}*/
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("non-200 response status=%d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read response body: %w", err)
+	}
+	html := string(body)
+
+	// Normalize
+	html = strings.ReplaceAll(html, "&nbsp;", " ")
+	html = regexp.MustCompile(`\s+`).ReplaceAllString(html, " ")
+	return html, nil
+}
+
+// homeStats holds the values of one home page. Numbers are -1 (timestamps 0)
+// when the page does not show them.
+type homeStats struct {
+	version, build string
+	started        int64
+	uptime         int64
+	// uptimeResolution is the unit the uptime is shown in, in seconds.
+	uptimeResolution int64
+
+	requests          float64
+	requestRate       float64
+	untiledRequests   float64
+	untiledRate       float64
+	bytes             float64
+	bandwidthMbps     float64
+	cacheHitPercent   float64
+	blankPercent      float64
+	peakRate          float64
+	peakRateTime      int64
+	peakBandwidthMbps float64
+	peakBandwidthTime int64
+	statsDelay        float64
+	intervals         []homeInterval
+
+	configFile, localStorage string
+
+	statsDisabled bool
+
+	parseErrors []fieldParseError
+
+	memcache *memcacheStats // nil when the section is absent
+}
+
+// fieldParseError is a page value that was found but not understood.
+type fieldParseError struct {
+	field string
+	err   error
+}
 
-func parseStartedUnix(html string) int64 {
-	// Case 1: value in the next <td> cell after the "Started:" header
-	reCell := regexp.MustCompile(`Started:\s*</th>\s*<td[^>]*>\s*([A-Za-z]{3}, [0-9]{1,2} [A-Za-z]{3} [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2} GMT)`)
-	if m := reCell.FindStringSubmatch(html); len(m) == 2 {
-		if t, err := time.Parse(time.RFC1123, m[1]); err == nil {
-			return t.Unix()
+type homeInterval struct {
+	window                      string // as shown, e.g. "15 seconds"
+	seconds                     int64
+	requests, rate, bytes, mbps float64
+}
+
+type memcacheStats struct {
+	requests          float64
+	hits              float64
+	misses            float64
+	hitPercent        float64
+	missPercent       float64
+	evicted           float64
+	occupationPercent float64
+	actualMB, totalMB float64
+}
+
+func parseHomePage(html string) homeStats {
+	var st homeStats
+	st.version, st.build = parseVersionBuild(html)
+	startedText, uptimeText := parseStartedText(html)
+	st.started = st.parseTime("started", startedText)
+	st.uptime, st.uptimeResolution = st.parseDuration("uptime", uptimeText)
+
+	st.requests = float64(parseFirstNumber(html, `Total number of requests:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`))
+	st.requestRate = parseFirstFloat(html, `Total number of requests:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*/s\s*\)\s*</td>`)
+	st.untiledRequests = float64(parseFirstNumber(html, `Total number of untiled WMS requests:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`))
+	st.untiledRate = parseFirstFloat(html, `Total number of untiled WMS requests:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*/s\s*\)\s*</td>`)
+	st.bytes = float64(parseFirstNumber(html, `Total number of bytes:\s*</th>\s*<td[^>]*>\s*([0-9,]+)`))
+	st.bandwidthMbps = parseFirstFloat(html, `Total number of bytes:\s*</th>\s*<td[^>]*>\s*[0-9,]+\s*\(\s*([0-9.]+)\s*mbps`)
+	st.cacheHitPercent = parseFirstFloat(html, `Cache hit ratio:\s*</th>\s*<td[^>]*>\s*([0-9.]+)% of requests`)
+	st.blankPercent = parseFirstFloat(html, `Blank/KML/HTML:\s*</th>\s*<td[^>]*>\s*([0-9.]+)% of requests`)
+	st.peakRate = parseFirstFloat(html, `Peak request rate:\s*</th>\s*<td[^>]*>\s*([0-9.]+)\s*/s`)
+	st.peakRateTime = st.parseTime("peak_request_rate_time", parseFirstString(html, `Peak request rate:\s*</th>\s*<td[^>]*>\s*[0-9.]+\s*/s\s*\(([^)]+)\)`))
+	st.peakBandwidthMbps = parseFirstFloat(html, `Peak bandwidth:\s*</th>\s*<td[^>]*>\s*([0-9.]+)\s*mbps`)
+	st.peakBandwidthTime = st.parseTime("peak_bandwidth_time", parseFirstString(html, `Peak bandwidth:\s*</th>\s*<td[^>]*>\s*[0-9.]+\s*mbps\s*\(([^)]+)\)`))
+	st.statsDelay = parseFirstFloat(html, `All figures are ([0-9.]+)\s*second\(s\) delayed`)
+
+	// GWC's window set is configurable, so every row of the interval table is
+	// read: window, requests, rate, bytes and bandwidth.
+	intervalRe := regexp.MustCompile(`<tr>\s*<td>\s*([^<]+?)\s*</td>\s*<td[^>]*>\s*([0-9,]+)\s*</td>\s*<td[^>]*>\s*([0-9.]+)\s*/s\s*</td>\s*<td[^>]*>\s*([0-9,]+)\s*</td>\s*<td[^>]*>\s*([0-9.]+)\s*mbps`)
+	seen := map[string]bool{}
+	for _, m := range intervalRe.FindAllStringSubmatch(html, -1) {
+		secs, _ := st.parseDuration("interval_window", m[1])
+		if secs <= 0 || seen[m[1]] {
+			continue
 		}
+		seen[m[1]] = true
+		st.intervals = append(st.intervals, homeInterval{
+			window:   m[1],
+			seconds:  secs,
+			requests: float64(toInt(m[2])),
+			rate:     toFloat(m[3]),
+			bytes:    float64(toInt(m[4])),
+			mbps:     toFloat(m[5]),
+		})
 	}
 
-	// Case 2: plain text after "Started:"
-	rePlain := regexp.MustCompile(`Started:\s*([A-Za-z]{3}, [0-9]{1,2} [A-Za-z]{3} [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2} GMT)`)
-	if m := rePlain.FindStringSubmatch(html); len(m) == 2 {
-		if t, err := time.Parse(time.RFC1123, m[1]); err == nil {
-			return t.Unix()
+	st.statsDisabled = statsDisabledRe.MatchString(html)
+
+	st.configFile = parseFirstString(html, `Config file:\s*</th>\s*<td[^>]*>\s*<tt>([^<]+)`)
+	st.localStorage = parseFirstString(html, `Local Storage:\s*</th>\s*<td[^>]*>\s*<tt>([^<]+)`)
+
+	if strings.Contains(html, "In Memory Cache Statistics") {
+		// Values are in the next <td> after the label
+		mc := &memcacheStats{
+			requests:          float64(parseFirstNumber(html, `Total number of requests:</td><td[^>]*>\s*([0-9,]+)`)),
+			hits:              float64(parseFirstNumber(html, `Internal Cache hit count:</td><td[^>]*>\s*([0-9,]+)`)),
+			misses:            float64(parseFirstNumber(html, `Internal Cache miss count:</td><td[^>]*>\s*([0-9,]+)`)),
+			hitPercent:        parseFirstFloat(html, `Internal Cache hit ratio:</td><td[^>]*>\s*([0-9.]+)\s*%`),
+			missPercent:       parseFirstFloat(html, `Internal Cache miss ratio:</td><td[^>]*>\s*([0-9.]+)\s*%`),
+			evicted:           float64(parseFirstNumber(html, `Total number of evicted tiles:</td><td[^>]*>\s*([0-9,]+)`)),
+			occupationPercent: parseFirstFloat(html, `Cache Memory occupation:</td><td[^>]*>\s*([0-9.]+)\s*%`),
 		}
+		mc.actualMB, mc.totalMB = parseSizesMB(html)
+		st.memcache = mc
 	}
+	return st
+}
 
-	return 0
+// intervalRateSummary condenses the per-window request rates into summary
+// form: the slowest, median and busiest window, their number and their sum.
+func intervalRateSummary(intervals []homeInterval) (uint64, float64, map[float64]float64) {
+	rates := make([]float64, 0, len(intervals))
+	sum := 0.0
+	for _, iv := range intervals {
+		rates = append(rates, iv.rate)
+		sum += iv.rate
+	}
+	sort.Float64s(rates)
+	quantiles := map[float64]float64{}
+	for _, q := range []float64{0, 0.5, 1} {
+		quantiles[q] = rates[int(q*float64(len(rates)-1)+0.5)]
+	}
+	return uint64(len(rates)), sum, quantiles
 }
 
-func parseRFC1123InParens(html, pattern string) int64 {
-	re := regexp.MustCompile(pattern)
-	m := re.FindStringSubmatch(html)
-	if len(m) < 2 {
-		return 0
+// recordParseErrors counts the fields that failed to parse and logs each
+// failure once until its message changes, so a page GWC always renders the
+// same way does not flood the log.
+func (c *gwcCollector) recordParseErrors(errs []fieldParseError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	failed := map[string]bool{}
+	for _, e := range errs {
+		failed[e.field] = true
+		c.parse_errors_total.WithLabelValues(e.field).Inc()
+		if msg := e.err.Error(); c.lastParseErrors[e.field] != msg {
+			c.lastParseErrors[e.field] = msg
+			log.Printf("gwc scrape: cannot parse field=%s target=%q err=%v", e.field, c.targetURL, e.err)
+		}
 	}
-	t, err := time.Parse(time.RFC1123, strings.TrimSpace(m[1]))
-	if err != nil {
-		return 0
+	for field := range c.lastParseErrors {
+		if !failed[field] {
+			delete(c.lastParseErrors, field)
+		}
+	}
+}
+
+// storagePaths returns the config file and local storage directory reported
+// by the last successful scrape.
+func (c *gwcCollector) storagePaths() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.configFile, c.localStorage
+}
+
+func parseVersionBuild(html string) (string, string) {
+	re := regexp.MustCompile(`Welcome to GeoWebCache version ([^,]+), build ([^<]+)`)
+	m := re.FindStringSubmatch(html)
+	if len(m) == 3 {
+		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
 	}
-	return t.Unix()
+	return "", ""
 }
 
-func parseUptimeSeconds(html string) int64 {
-	re := regexp.MustCompile(`Started:.*\(([0-9.]+)\s*(seconds|second|minutes|minute|hours|hour|days|day)\)`)
+// parseStartedText returns the start time and the uptime in parentheses after
+// "Started:", either in the next <td> cell or as plain text.
+func parseStartedText(html string) (string, string) {
+	re := regexp.MustCompile(`Started:\s*(?:</th>\s*<td[^>]*>)?\s*([^(<]+?)\s*(?:\(([^)<]*)\))?\s*<`)
 	m := re.FindStringSubmatch(html)
 	if len(m) != 3 {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// parseTime parses a page timestamp, recording a parse error when the text is
+// there but not understood.
+func (st *homeStats) parseTime(field, text string) int64 {
+	if text == "" {
 		return 0
 	}
-	val := toFloat(m[1])
-	unit := strings.ToLower(m[2])
-	switch {
-	case strings.HasPrefix(unit, "second"):
-		return int64(val)
-	case strings.HasPrefix(unit, "minute"):
-		return int64(val * 60)
-	case strings.HasPrefix(unit, "hour"):
-		return int64(val * 3600)
-	case strings.HasPrefix(unit, "day"):
-		return int64(val * 86400)
-	default:
+	t, err := parsePageTime(text)
+	if err != nil {
+		st.parseErrors = append(st.parseErrors, fieldParseError{field, err})
 		return 0
 	}
+	return t
+}
+
+// parseDuration is parseTime for durations; it also returns the unit.
+func (st *homeStats) parseDuration(field, text string) (int64, int64) {
+	if text == "" {
+		return 0, 0
+	}
+	secs, resolution, err := parsePageDuration(text)
+	if err != nil {
+		st.parseErrors = append(st.parseErrors, fieldParseError{field, err})
+		return 0, 0
+	}
+	return secs, resolution
 }
 
 func parseSizesMB(html string) (float64, float64) {
@@ -457,6 +956,66 @@ func envOrDefault(key, fallback string) string {
 	return fallback
 }
 
+// stringList is a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// envList splits a newline separated environment variable.
+func envList(key string) stringList {
+	var out stringList
+	for _, l := range strings.Split(envOrDefault(key, ""), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func envIntOrDefault(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("invalid %s=%q, using default %d", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+func envBoolOrDefault(key string, fallback bool) bool {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("invalid %s=%q, using default %t", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+func envFloatOrDefault(key string, fallback float64) float64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("invalid %s=%q, using default %g", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
 func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
 	raw := strings.TrimSpace(os.Getenv(key))
 	if raw == "" {
@@ -492,20 +1051,457 @@ func main() {
 			envDurationOrDefault("GWC_SCRAPE_TIMEOUT", 5*time.Second),
 			"HTTP timeout when scraping the target URL. Can also be set by GWC_SCRAPE_TIMEOUT (e.g. 5s).",
 		)
+		metricsNaming = flag.String(
+			"metrics.naming",
+			envOrDefault("GWC_METRICS_NAMING", "v1"),
+			"Home page metric names: v1 (original) or v2 (base units, 0-1 ratios, created timestamps). Can also be set by GWC_METRICS_NAMING.",
+		)
+		metricsLegacyNames = flag.Bool(
+			"metrics.legacy-names",
+			envBoolOrDefault("GWC_METRICS_LEGACY_NAMES", false),
+			"With -metrics.naming=v2, also emit the v1 names during a migration. Can also be set by GWC_METRICS_LEGACY_NAMES.",
+		)
+		staleScrapes = flag.Int(
+			"stats.stale-scrapes",
+			envIntOrDefault("GWC_STATS_STALE_SCRAPES", 5),
+			"Consecutive scrapes with unchanged runtime statistics (while the interval rows show traffic) before gwc_runtime_stats_stale is set; 0 disables. Can also be set by GWC_STATS_STALE_SCRAPES.",
+		)
+		peaksHistory = flag.Int(
+			"peaks.history",
+			envIntOrDefault("GWC_PEAKS_HISTORY", 100),
+			"New peak events kept in memory and listed at /peaks; 0 keeps none. Can also be set by GWC_PEAKS_HISTORY.",
+		)
+		peaksLog = flag.Bool(
+			"peaks.log",
+			envBoolOrDefault("GWC_PEAKS_LOG", false),
+			"Log every new peak as a key=value line. Can also be set by GWC_PEAKS_LOG.",
+		)
+		clusterTargets         stringList
+		clusterRefreshInterval = flag.Duration(
+			"cluster.refresh-interval",
+			envDurationOrDefault("GWC_CLUSTER_REFRESH_INTERVAL", 30*time.Second),
+			"How often dns+ and dnssrv+ cluster targets are resolved again and file_sd files are checked for changes. Can also be set by GWC_CLUSTER_REFRESH_INTERVAL.",
+		)
+		clusterConfigHash = flag.Bool(
+			"cluster.config-hash",
+			envBoolOrDefault("GWC_CLUSTER_CONFIG_HASH", false),
+			"In cluster mode, fetch every node's WMTS capabilities on each scrape to detect configuration drift; the requests use the -rest.* credentials. Can also be set by GWC_CLUSTER_CONFIG_HASH.",
+		)
+		fileSDFiles stringList
+		fileSDPath  = flag.String(
+			"file-sd.path",
+			envOrDefault("GWC_FILE_SD_PATH", "/geowebcache"),
+			"Home page path for file_sd targets given as host:port without a __metrics_path__ label. Can also be set by GWC_FILE_SD_PATH.",
+		)
+		kubernetesSD = flag.Bool(
+			"kubernetes.sd",
+			envBoolOrDefault("GWC_KUBERNETES_SD", false),
+			"Discover GWC pods through the Kubernetes API and scrape them in cluster mode. Can also be set by GWC_KUBERNETES_SD.",
+		)
+		kubernetesNamespaces stringList
+		kubernetesSelector   = flag.String(
+			"kubernetes.selector",
+			envOrDefault("GWC_KUBERNETES_SELECTOR", ""),
+			"Label selector for GWC pods (e.g. app=geowebcache). Can also be set by GWC_KUBERNETES_SELECTOR.",
+		)
+		kubernetesPortName = flag.String(
+			"kubernetes.port-name",
+			envOrDefault("GWC_KUBERNETES_PORT_NAME", "http"),
+			"Name of the container port serving GWC. Can also be set by GWC_KUBERNETES_PORT_NAME.",
+		)
+		kubernetesPathAnnotation = flag.String(
+			"kubernetes.path-annotation",
+			envOrDefault("GWC_KUBERNETES_PATH_ANNOTATION", "gwc-exporter/path"),
+			"Pod annotation holding the home page path. Can also be set by GWC_KUBERNETES_PATH_ANNOTATION.",
+		)
+		kubernetesPath = flag.String(
+			"kubernetes.path",
+			envOrDefault("GWC_KUBERNETES_PATH", "/geowebcache"),
+			"Home page path for pods without the path annotation. Can also be set by GWC_KUBERNETES_PATH.",
+		)
+		kubernetesAPIServer = flag.String(
+			"kubernetes.api-server",
+			envOrDefault("GWC_KUBERNETES_API_SERVER", ""),
+			"Kubernetes API server URL without credentials (e.g. kubectl proxy); empty uses the in-cluster service account. Can also be set by GWC_KUBERNETES_API_SERVER.",
+		)
+		stateFile = flag.String(
+			"state.file",
+			envOrDefault("GWC_STATE_FILE", ""),
+			"JSON file in which the exporter keeps counter offsets across GWC and exporter restarts, for the *_cumulative_total counters; empty disables. Can also be set by GWC_STATE_FILE.",
+		)
+		stateRetention = flag.Duration(
+			"state.retention",
+			envDurationOrDefault("GWC_STATE_RETENTION", 7*24*time.Hour),
+			"Drop the counter offsets, peak marks and cluster totals of targets not scraped successfully for this long, so discovered targets that went away do not pile up; 0 keeps them forever. Can also be set by GWC_STATE_RETENTION.",
+		)
+		accessLogPath = flag.String(
+			"accesslog.path",
+			envOrDefault("GWC_ACCESSLOG_PATH", ""),
+			"Tomcat access log file or glob to follow (e.g. /logs/localhost_access_log.*.txt); empty disables. Can also be set by GWC_ACCESSLOG_PATH.",
+		)
+		accessLogPattern = flag.String(
+			"accesslog.pattern",
+			envOrDefault("GWC_ACCESSLOG_PATTERN", "common"),
+			"AccessLogValve pattern of the access log, or common/combined. Can also be set by GWC_ACCESSLOG_PATTERN.",
+		)
+		accessLogDurationUnit = flag.String(
+			"accesslog.duration-unit",
+			envOrDefault("GWC_ACCESSLOG_DURATION_UNIT", "ms"),
+			"Unit of %D in the access log: ms (Tomcat 9 and older) or us (Tomcat 10.1+). Can also be set by GWC_ACCESSLOG_DURATION_UNIT.",
+		)
+		appLogPath = flag.String(
+			"applog.path",
+			envOrDefault("GWC_APPLOG_PATH", ""),
+			"GeoWebCache application log (geowebcache.log) file or glob to follow; empty disables. Can also be set by GWC_APPLOG_PATH.",
+		)
+		appLogClassifiers stringList
+		tomcatManagerURL  = flag.String(
+			"tomcat.manager-url",
+			envOrDefault("GWC_TOMCAT_MANAGER_URL", ""),
+			"Base URL of the Tomcat manager hosting GWC (e.g. http://geowebcache:8080/manager); empty disables. Can also be set by GWC_TOMCAT_MANAGER_URL.",
+		)
+		tomcatUsername = flag.String(
+			"tomcat.username",
+			envOrDefault("GWC_TOMCAT_USERNAME", ""),
+			"Tomcat manager user (manager-status role, manager-script for sessions). Can also be set by GWC_TOMCAT_USERNAME.",
+		)
+		tomcatPassword = flag.String(
+			"tomcat.password",
+			envOrDefault("GWC_TOMCAT_PASSWORD", ""),
+			"Tomcat manager password. Can also be set by GWC_TOMCAT_PASSWORD.",
+		)
+		tomcatPasswordFile = flag.String(
+			"tomcat.password-file",
+			envOrDefault("GWC_TOMCAT_PASSWORD_FILE", ""),
+			"File containing the Tomcat manager password; overrides -tomcat.password. Can also be set by GWC_TOMCAT_PASSWORD_FILE.",
+		)
+		jolokiaURL = flag.String(
+			"jolokia.url",
+			envOrDefault("GWC_JOLOKIA_URL", ""),
+			"Jolokia agent URL of the GWC JVM (e.g. http://geowebcache:8080/jolokia/); empty disables. Can also be set by GWC_JOLOKIA_URL.",
+		)
+		jolokiaUsername = flag.String(
+			"jolokia.username",
+			envOrDefault("GWC_JOLOKIA_USERNAME", ""),
+			"Jolokia user. Can also be set by GWC_JOLOKIA_USERNAME.",
+		)
+		jolokiaPassword = flag.String(
+			"jolokia.password",
+			envOrDefault("GWC_JOLOKIA_PASSWORD", ""),
+			"Jolokia password. Can also be set by GWC_JOLOKIA_PASSWORD.",
+		)
+		jolokiaPasswordFile = flag.String(
+			"jolokia.password-file",
+			envOrDefault("GWC_JOLOKIA_PASSWORD_FILE", ""),
+			"File containing the Jolokia password; overrides -jolokia.password. Can also be set by GWC_JOLOKIA_PASSWORD_FILE.",
+		)
+		jolokiaMBeans stringList
+		configPath    = flag.String(
+			"gwc-config.path",
+			envOrDefault("GWC_CONFIG_PATH", ""),
+			"Path of geowebcache.xml readable by the exporter, or \"auto\" to use the Config file from the home page; empty disables. Can also be set by GWC_CONFIG_PATH.",
+		)
+		storagePath = flag.String(
+			"storage.path",
+			envOrDefault("GWC_STORAGE_PATH", ""),
+			"Tile cache directory to report filesystem capacity for (linux only), or \"auto\" to use the Local Storage directory from the home page; empty disables. Can also be set by GWC_STORAGE_PATH.",
+		)
+		mbtilesPaths        stringList
+		mbtilesScanInterval = flag.Duration(
+			"mbtiles.scan-interval",
+			envDurationOrDefault("GWC_MBTILES_SCAN_INTERVAL", 10*time.Minute),
+			"Interval between MBTiles/SQLite blob store scans. Can also be set by GWC_MBTILES_SCAN_INTERVAL.",
+		)
+		s3Bucket = flag.String(
+			"s3.bucket",
+			envOrDefault("GWC_S3_BUCKET", ""),
+			"S3 bucket of the GWC S3 blob store, \"config\" for the S3 blob stores in geowebcache.xml, or \"rest\" for those of /rest/blobstores (needs -rest.username); empty disables. Can also be set by GWC_S3_BUCKET.",
+		)
+		s3Prefix = flag.String(
+			"s3.prefix",
+			envOrDefault("GWC_S3_PREFIX", ""),
+			"Key prefix of the S3 blob store. Can also be set by GWC_S3_PREFIX.",
+		)
+		s3Endpoint = flag.String(
+			"s3.endpoint",
+			envOrDefault("GWC_S3_ENDPOINT", ""),
+			"S3-compatible endpoint (e.g. http://minio:9000); empty uses AWS for -s3.region. Can also be set by GWC_S3_ENDPOINT.",
+		)
+		s3Region = flag.String(
+			"s3.region",
+			envOrDefault("GWC_S3_REGION", "us-east-1"),
+			"Region used for request signing. Can also be set by GWC_S3_REGION.",
+		)
+		s3ScanInterval = flag.Duration(
+			"s3.scan-interval",
+			envDurationOrDefault("GWC_S3_SCAN_INTERVAL", time.Hour),
+			"Interval between S3 listing cycles. Can also be set by GWC_S3_SCAN_INTERVAL.",
+		)
+		s3RequestBudget = flag.Int(
+			"s3.request-budget",
+			envIntOrDefault("GWC_S3_REQUEST_BUDGET", 1000),
+			"Maximum ListObjectsV2 requests per cycle (0 = unlimited); larger buckets are listed over several cycles. Can also be set by GWC_S3_REQUEST_BUDGET.",
+		)
+		s3RequestPace = flag.Duration(
+			"s3.request-pace",
+			envDurationOrDefault("GWC_S3_REQUEST_PACE", 200*time.Millisecond),
+			"Pause between ListObjectsV2 requests. Can also be set by GWC_S3_REQUEST_PACE.",
+		)
+		arcgisPaths        stringList
+		arcgisScanInterval = flag.Duration(
+			"arcgis.scan-interval",
+			envDurationOrDefault("GWC_ARCGIS_SCAN_INTERVAL", time.Hour),
+			"Interval between ArcGIS cache scans. Can also be set by GWC_ARCGIS_SCAN_INTERVAL.",
+		)
+		diskPaths        stringList
+		diskScanInterval = flag.Duration(
+			"disk.scan-interval",
+			envDurationOrDefault("GWC_DISK_SCAN_INTERVAL", time.Hour),
+			"Interval between file blob store scans. Can also be set by GWC_DISK_SCAN_INTERVAL.",
+		)
+		diskBlankSampleRate = flag.Float64(
+			"disk.blank-sample-rate",
+			envFloatOrDefault("GWC_DISK_BLANK_SAMPLE_RATE", 0),
+			"Share of PNG/JPEG tiles (0-1) decoded during disk scans to detect empty and single-color tiles; 0 disables. Can also be set by GWC_DISK_BLANK_SAMPLE_RATE.",
+		)
+		diskBlankBudget = flag.Duration(
+			"disk.blank-cpu-budget",
+			envDurationOrDefault("GWC_DISK_BLANK_CPU_BUDGET", 30*time.Second),
+			"Maximum time spent decoding tiles per disk scan. Can also be set by GWC_DISK_BLANK_CPU_BUDGET.",
+		)
+		diskWatch = flag.Bool(
+			"disk.watch",
+			envBoolOrDefault("GWC_DISK_WATCH", false),
+			"Watch the -disk.path directories with inotify and count tile writes and deletes as they happen (Linux only). Can also be set by GWC_DISK_WATCH.",
+		)
+		diskWatchLimit = flag.Int(
+			"disk.watch-limit",
+			envIntOrDefault("GWC_DISK_WATCH_LIMIT", 65536),
+			"Maximum number of directories watched by -disk.watch. Can also be set by GWC_DISK_WATCH_LIMIT.",
+		)
+		restUsername = flag.String(
+			"rest.username",
+			envOrDefault("GWC_REST_USERNAME", ""),
+			"GWC REST API user, used to cross-check capabilities against /rest/layers. Can also be set by GWC_REST_USERNAME.",
+		)
+		restPassword = flag.String(
+			"rest.password",
+			envOrDefault("GWC_REST_PASSWORD", ""),
+			"GWC REST API password. Can also be set by GWC_REST_PASSWORD.",
+		)
+		restPasswordFile = flag.String(
+			"rest.password-file",
+			envOrDefault("GWC_REST_PASSWORD_FILE", ""),
+			"File containing the GWC REST API password; overrides -rest.password. Can also be set by GWC_REST_PASSWORD_FILE.",
+		)
+		wmtsCapabilities = flag.Bool(
+			"wmts.capabilities",
+			envBoolOrDefault("GWC_WMTS_CAPABILITIES", false),
+			"Fetch and validate the WMTS GetCapabilities document of the target on every scrape. Can also be set by GWC_WMTS_CAPABILITIES.",
+		)
+		serviceProbeList stringList
 	)
+	flag.Var(&appLogClassifiers, "applog.classifier", "Application log classifier as class=regex; repeatable. Can also be set by GWC_APPLOG_CLASSIFIERS (one per line).")
+	flag.Var(&jolokiaMBeans, "jolokia.mbean", "Extra MBean attribute as metric=mbean;attribute[;path]; repeatable. Can also be set by GWC_JOLOKIA_MBEANS (one per line).")
+	flag.Var(&mbtilesPaths, "mbtiles.path", "MBTiles/SQLite file, directory or glob to scan, or \"config\" for the MBTiles blob stores in geowebcache.xml; repeatable. Can also be set by GWC_MBTILES_PATHS (one per line).")
+	flag.Var(&arcgisPaths, "arcgis.path", "ArcGIS cache directory or conf.xml to scan, or \"config\" for the arcgisLayers in geowebcache.xml; repeatable. Can also be set by GWC_ARCGIS_PATHS (one per line).")
+	flag.Var(&diskPaths, "disk.path", "File blob store directory to scan, \"auto\" for the Local Storage directory on the home page, or \"config\" for the file blob stores in geowebcache.xml; repeatable. Can also be set by GWC_DISK_PATHS (one per line).")
+	flag.Var(&serviceProbeList, "service.probe", "GWC service endpoint to probe on every scrape: tms or wmsc; repeatable. Can also be set by GWC_SERVICE_PROBES (one per line).")
+	flag.Var(&clusterTargets, "cluster.target", "GWC node home page URL for cluster mode, optionally followed by name=value labels; dns+<url> resolves A/AAAA records of the host, dnssrv+<url> an SRV record; repeatable. Replaces -target.url for the home page metrics. Can also be set by GWC_CLUSTER_TARGETS (one per line).")
+	flag.Var(&fileSDFiles, "file-sd.file", "Prometheus file_sd JSON or YAML file (or glob) with GWC targets for cluster mode, watched for changes; repeatable. Can also be set by GWC_FILE_SD_FILES (one per line).")
+	flag.Var(&kubernetesNamespaces, "kubernetes.namespace", "Namespace to discover GWC pods in; repeatable, none for all namespaces. Can also be set by GWC_KUBERNETES_NAMESPACES (one per line).")
 	flag.Parse()
+	if len(appLogClassifiers) == 0 {
+		appLogClassifiers = envList("GWC_APPLOG_CLASSIFIERS")
+	}
+	if len(jolokiaMBeans) == 0 {
+		jolokiaMBeans = envList("GWC_JOLOKIA_MBEANS")
+	}
+	if len(mbtilesPaths) == 0 {
+		mbtilesPaths = envList("GWC_MBTILES_PATHS")
+	}
+	if len(arcgisPaths) == 0 {
+		arcgisPaths = envList("GWC_ARCGIS_PATHS")
+	}
+	if len(diskPaths) == 0 {
+		diskPaths = envList("GWC_DISK_PATHS")
+	}
+	if len(serviceProbeList) == 0 {
+		serviceProbeList = envList("GWC_SERVICE_PROBES")
+	}
+	if len(clusterTargets) == 0 {
+		clusterTargets = envList("GWC_CLUSTER_TARGETS")
+	}
+	if len(fileSDFiles) == 0 {
+		fileSDFiles = envList("GWC_FILE_SD_FILES")
+	}
+	if len(kubernetesNamespaces) == 0 {
+		kubernetesNamespaces = envList("GWC_KUBERNETES_NAMESPACES")
+	}
+
+	ctx := context.Background()
+
+	var state *counterState
+	if *stateFile != "" {
+		var err error
+		if state, err = loadCounterState(*stateFile, *stateRetention); err != nil {
+			log.Fatalf("load state file: %v", err)
+		}
+	}
 
-	collector := newGwcCollector(*url, *timeout)
+	naming, err := parseMetricNaming(*metricsNaming, *metricsLegacyNames)
+	if err != nil {
+		log.Fatalf("metrics naming: %v", err)
+	}
+
+	peaks := newPeakTracker(*peaksHistory, *peaksLog, *stateRetention)
+	collector := newGwcCollector(*url, *timeout, state, naming, *staleScrapes, peaks, nil)
 	reg := prometheus.NewRegistry()
-	if err := reg.Register(collector); err != nil {
+	sources, err := parseTargetSpecs(clusterTargets, *clusterRefreshInterval)
+	if err != nil {
+		log.Fatalf("cluster targets: %v", err)
+	}
+	if len(fileSDFiles) > 0 {
+		sources = append(sources, newFileSDSource(fileSDFiles, *fileSDPath, *clusterRefreshInterval))
+	}
+	if *kubernetesSD {
+		api, err := newKubeAPI(*kubernetesAPIServer)
+		if err != nil {
+			log.Fatalf("kubernetes discovery: %v", err)
+		}
+		sources = append(sources, newKubernetesSource(api, kubernetesNamespaces, *kubernetesSelector, *kubernetesPortName, *kubernetesPathAnnotation, *kubernetesPath))
+	}
+	restAuth := basicAuth{username: *restUsername, password: *restPassword, passwordFile: *restPasswordFile}
+	if len(sources) > 0 {
+		if err := checkClusterFlags(*configPath, *storagePath, diskPaths, *wmtsCapabilities, serviceProbeList, *s3Bucket); err != nil {
+			log.Fatalf("cluster mode: %v", err)
+		}
+		cc := newClusterCollector(sources, naming, *clusterConfigHash, restAuth, *timeout, *stateRetention, func(t target, labels prometheus.Labels) *gwcCollector {
+			return newGwcCollector(t.url, *timeout, state, naming, *staleScrapes, peaks, labels)
+		})
+		cc.run(ctx)
+		if err := reg.Register(cc); err != nil {
+			log.Fatalf("register cluster collector: %v", err)
+		}
+	} else if err := reg.Register(collector); err != nil {
 		log.Fatalf("register collector: %v", err)
 	}
 
+	if *accessLogPath != "" {
+		if err := startAccessLogCollector(ctx, reg, *accessLogPath, *accessLogPattern, *accessLogDurationUnit); err != nil {
+			log.Fatalf("access log collector: %v", err)
+		}
+	}
+	if *appLogPath != "" {
+		if err := startAppLogCollector(ctx, reg, *appLogPath, appLogClassifiers); err != nil {
+			log.Fatalf("application log collector: %v", err)
+		}
+	}
+	if *tomcatManagerURL != "" {
+		auth := basicAuth{username: *tomcatUsername, password: *tomcatPassword, passwordFile: *tomcatPasswordFile}
+		if err := reg.Register(newTomcatCollector(*tomcatManagerURL, auth, *timeout)); err != nil {
+			log.Fatalf("register tomcat collector: %v", err)
+		}
+	}
+	// currentConfig is shared by the collectors that need the layer/blob store setup.
+	var configCollector *gwcConfigCollector
+	currentConfig := func() *gwcConfig {
+		if configCollector == nil {
+			return nil
+		}
+		return configCollector.current()
+	}
+	if *configPath != "" {
+		configCollector = newGwcConfigCollector(*configPath, collector.storagePaths)
+		if err := reg.Register(configCollector); err != nil {
+			log.Fatalf("register config collector: %v", err)
+		}
+	}
+	if *storagePath != "" {
+		if err := reg.Register(newStorageFSCollector(*storagePath, collector.storagePaths)); err != nil {
+			log.Fatalf("register storage fs collector: %v", err)
+		}
+	}
+	if len(mbtilesPaths) > 0 {
+		mc := newMbtilesCollector(mbtilesPaths, currentConfig, *mbtilesScanInterval)
+		if err := reg.Register(mc); err != nil {
+			log.Fatalf("register mbtiles collector: %v", err)
+		}
+		go mc.run(ctx)
+	}
+	if *s3Bucket != "" {
+		fallback := s3DefaultStore(*s3Bucket, *s3Prefix, *s3Endpoint, *s3Region)
+		stores := func() []s3BlobStore { return []s3BlobStore{fallback} }
+		switch *s3Bucket {
+		case "config":
+			stores = func() []s3BlobStore { return s3BlobStoresFromConfig(currentConfig(), fallback) }
+		case "rest":
+			stores = s3RESTStores(*url, restAuth, fallback, *timeout)
+		}
+		sc := newS3Collector(stores, *s3ScanInterval, *s3RequestBudget, *s3RequestPace, *timeout)
+		if err := reg.Register(sc); err != nil {
+			log.Fatalf("register s3 collector: %v", err)
+		}
+		go sc.run(ctx)
+	}
+	if len(arcgisPaths) > 0 {
+		ac := newArcgisCollector(arcgisPaths, currentConfig, *arcgisScanInterval)
+		if err := reg.Register(ac); err != nil {
+			log.Fatalf("register arcgis collector: %v", err)
+		}
+		go ac.run(ctx)
+	}
+	if len(diskPaths) > 0 {
+		dc := newDiskScanCollector(diskPaths, collector.storagePaths, currentConfig, *diskScanInterval, *diskBlankSampleRate, *diskBlankBudget)
+		if err := reg.Register(dc); err != nil {
+			log.Fatalf("register disk scan collector: %v", err)
+		}
+		go dc.run(ctx)
+
+		if *diskWatch {
+			tw := newTileWatchCollector(dc.roots, *diskWatchLimit)
+			if err := reg.Register(tw); err != nil {
+				log.Fatalf("register tile watch collector: %v", err)
+			}
+			go tw.run(ctx)
+		}
+	}
+	if *jolokiaURL != "" {
+		auth := basicAuth{username: *jolokiaUsername, password: *jolokiaPassword, passwordFile: *jolokiaPasswordFile}
+		jc, err := newJolokiaCollector(*jolokiaURL, auth, *timeout, jolokiaMBeans)
+		if err != nil {
+			log.Fatalf("jolokia collector: %v", err)
+		}
+		if err := reg.Register(jc); err != nil {
+			log.Fatalf("register jolokia collector: %v", err)
+		}
+	}
+
+	if *wmtsCapabilities {
+		if err := reg.Register(newWmtsCollector(*url, restAuth, *timeout)); err != nil {
+			log.Fatalf("register wmts collector: %v", err)
+		}
+	}
+	if len(serviceProbeList) > 0 {
+		svc, err := newServiceCollector(*url, serviceProbeList, *timeout)
+		if err != nil {
+			log.Fatalf("service probe collector: %v", err)
+		}
+		if err := reg.Register(svc); err != nil {
+			log.Fatalf("register service probe collector: %v", err)
+		}
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle(*path, promhttp.HandlerFor(reg, promhttp.HandlerOpts{
 		EnableOpenMetrics: true,
+		// _created samples for counters, derived from the GWC start time in v2.
+		EnableOpenMetricsTextCreatedSamples: naming.v2,
 	}))
 
+	// new peak events
+	mux.Handle("/peaks", peaks)
+
 	// basic liveness
 	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -518,7 +1514,11 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	log.Printf("GWC exporter listening on %s, scraping %s", *addr, *url)
+	if len(sources) > 0 {
+		log.Printf("GWC exporter listening on %s, cluster mode with %d target sources", *addr, len(sources))
+	} else {
+		log.Printf("GWC exporter listening on %s, scraping %s", *addr, *url)
+	}
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("http server: %v", err)
 	}
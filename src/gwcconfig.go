@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Grid sets GWC defines in code; they are never listed in geowebcache.xml.
+var builtinGridSets = []struct{ name, srs string }{
+	{"EPSG:4326", "EPSG:4326"},
+	{"EPSG:900913", "EPSG:900913"},
+	{"GoogleMapsCompatible", "EPSG:900913"},
+	{"GlobalCRS84Pixel", "EPSG:4326"},
+	{"GlobalCRS84Scale", "EPSG:4326"},
+	{"GlobalCRS84Geometric", "EPSG:4326"},
+}
+
+// gwcConfig is the subset of geowebcache.xml the exporter cares about.
+type gwcConfig struct {
+	Version    string `xml:"version"`
+	BlobStores struct {
+		Items []gwcConfigBlobStore `xml:",any"`
+	} `xml:"blobStores"`
+	GridSets []struct {
+		Name string `xml:"name"`
+		SRS  string `xml:"srs>number"`
+	} `xml:"gridSets>gridSet"`
+	Layers struct {
+		Items []gwcConfigLayer `xml:",any"`
+	} `xml:"layers"`
+}
+
+type gwcConfigBlobStore struct {
+	XMLName xml.Name // FileBlobStore, S3BlobStore, MbtilesBlobStore, ...
+	Default string   `xml:"default,attr"`
+	ID      string   `xml:"id"`
+	Enabled string   `xml:"enabled"`
+
+	BaseDirectory string `xml:"baseDirectory"` // file
+	RootDirectory string `xml:"rootDirectory"` // mbtiles/sqlite
+	Bucket        string `xml:"bucket"`        // s3
+	Prefix        string `xml:"prefix"`        // s3
+	Endpoint      string `xml:"endpoint"`      // s3
+	AccessKey     string `xml:"awsAccessKey"`  // s3
+	SecretKey     string `xml:"awsSecretKey"`  // s3
+}
+
+type gwcConfigLayer struct {
+	XMLName     xml.Name // wmsLayer, arcgisLayer, ...
+	Name        string   `xml:"name"`
+	Enabled     string   `xml:"enabled"`
+	BlobStoreID string   `xml:"blobStoreId"`
+	MimeFormats []string `xml:"mimeFormats>string"`
+	GridSubsets []struct {
+		GridSetName string `xml:"gridSetName"`
+		ZoomStart   string `xml:"zoomStart"`
+		ZoomStop    string `xml:"zoomStop"`
+	} `xml:"gridSubsets>gridSubset"`
+	ExpireCache     string `xml:"expireCache"`
+	ExpirationRules []struct {
+		MinZoom    int `xml:"minZoom,attr"`
+		Expiration int `xml:"expiration,attr"`
+	} `xml:"expireCacheList>expirationRule"`
+
+	TilingScheme  string `xml:"tilingScheme"`  // arcgis conf.xml
+	TileCachePath string `xml:"tileCachePath"` // arcgis _alllayers parent
+}
+
+// expireSeconds returns the cache expiry of the layer at zoom, 0 if the
+// tiles never expire. Positive values are seconds; GWC uses 0 and negative
+// values for "unset", "never" and "use backend headers".
+func (l gwcConfigLayer) expireSeconds(zoom int) int {
+	exp := 0
+	minZoom := -1
+	for _, r := range l.ExpirationRules {
+		if r.MinZoom <= zoom && r.MinZoom > minZoom {
+			exp, minZoom = r.Expiration, r.MinZoom
+		}
+	}
+	if minZoom < 0 {
+		exp, _ = strconv.Atoi(l.ExpireCache)
+	}
+	if exp < 0 {
+		return 0
+	}
+	return exp
+}
+
+func (b gwcConfigBlobStore) isDefault() bool { return b.Default == "true" }
+
+// enabledString treats a missing <enabled> as true, like GWC does.
+func enabledString(s string) string {
+	if s == "false" {
+		return "false"
+	}
+	return "true"
+}
+
+func parseGwcConfig(data []byte) (*gwcConfig, error) {
+	var cfg gwcConfig
+	if err := xml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// gwcConfigFile caches the parsed geowebcache.xml and reloads it when its
+// modification time or size changes.
+type gwcConfigFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	hash    string
+	cfg     *gwcConfig
+}
+
+// load returns the current config; path may change between calls when it is
+// taken from the home page.
+func (f *gwcConfigFile) load(path string) (*gwcConfig, os.FileInfo, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if f.cfg != nil && path == f.path && st.ModTime().Equal(f.modTime) && st.Size() == f.size {
+		return f.cfg, st, f.hash, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cfg, err := parseGwcConfig(data)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("parse %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	f.path, f.modTime, f.size, f.cfg = path, st.ModTime(), st.Size(), cfg
+	f.hash = hex.EncodeToString(sum[:])[:16]
+	return cfg, st, f.hash, nil
+}
+
+// gwcConfigCollector exports the layer, grid set, blob store and format
+// inventory straight from geowebcache.xml, without REST credentials. With
+// path "auto" the config file reported on the home page is used.
+type gwcConfigCollector struct {
+	path      string
+	homePaths func() (configFile, localStorage string)
+	file      gwcConfigFile
+
+	up                   *prometheus.Desc
+	last_modified        *prometheus.Desc
+	info                 *prometheus.Desc // labels: version, hash
+	layers               *prometheus.Desc
+	layer_info           *prometheus.Desc // labels: layer, type, blob_store, enabled
+	layer_gridset_info   *prometheus.Desc // labels: layer, gridset, zoom_start, zoom_stop
+	layer_format_info    *prometheus.Desc // labels: layer, format
+	layer_expire_seconds *prometheus.Desc // label: layer
+	gridsets             *prometheus.Desc
+	gridset_info         *prometheus.Desc // labels: gridset, srs, builtin
+	blobstores           *prometheus.Desc
+	blobstore_info       *prometheus.Desc // labels: blob_store, type, enabled, default
+}
+
+func newGwcConfigCollector(path string, homePaths func() (string, string)) *gwcConfigCollector {
+	const ns = "gwc_config"
+	return &gwcConfigCollector{
+		path:      path,
+		homePaths: homePaths,
+
+		up:                   prometheus.NewDesc(ns+"_up", "Was geowebcache.xml read and parsed successfully.", nil, nil),
+		last_modified:        prometheus.NewDesc(ns+"_last_modified_seconds", "Modification time of geowebcache.xml.", nil, nil),
+		info:                 prometheus.NewDesc(ns+"_info", "Config version and content hash (sha256 prefix) as labels; value 1.", []string{"version", "hash"}, nil),
+		layers:               prometheus.NewDesc(ns+"_layers", "Number of configured layers.", nil, nil),
+		layer_info:           prometheus.NewDesc(ns+"_layer_info", "Configured layer; value 1.", []string{"layer", "type", "blob_store", "enabled"}, nil),
+		layer_gridset_info:   prometheus.NewDesc(ns+"_layer_gridset_info", "Grid subset of a configured layer; value 1.", []string{"layer", "gridset", "zoom_start", "zoom_stop"}, nil),
+		layer_format_info:    prometheus.NewDesc(ns+"_layer_format_info", "Mime format of a configured layer; value 1.", []string{"layer", "format"}, nil),
+		layer_expire_seconds: prometheus.NewDesc(ns+"_layer_expire_cache_seconds", "Configured expireCache of the layer (0 = never expires).", []string{"layer"}, nil),
+		gridsets:             prometheus.NewDesc(ns+"_gridsets", "Number of grid sets (configured and built-in).", nil, nil),
+		gridset_info:         prometheus.NewDesc(ns+"_gridset_info", "Grid set; value 1.", []string{"gridset", "srs", "builtin"}, nil),
+		blobstores:           prometheus.NewDesc(ns+"_blobstores", "Number of configured blob stores.", nil, nil),
+		blobstore_info:       prometheus.NewDesc(ns+"_blobstore_info", "Configured blob store; value 1.", []string{"blob_store", "type", "enabled", "default"}, nil),
+	}
+}
+
+// resolvePath returns the config path, following the home page for "auto".
+func (c *gwcConfigCollector) resolvePath() string {
+	if c.path != "auto" {
+		return c.path
+	}
+	if c.homePaths == nil {
+		return ""
+	}
+	configFile, _ := c.homePaths()
+	return configFile
+}
+
+// current loads the config for other collectors (expiry, blob store lookup).
+func (c *gwcConfigCollector) current() *gwcConfig {
+	path := c.resolvePath()
+	if path == "" {
+		return nil
+	}
+	cfg, _, _, err := c.file.load(path)
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+func (c *gwcConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.last_modified
+	ch <- c.info
+	ch <- c.layers
+	ch <- c.layer_info
+	ch <- c.layer_gridset_info
+	ch <- c.layer_format_info
+	ch <- c.layer_expire_seconds
+	ch <- c.gridsets
+	ch <- c.gridset_info
+	ch <- c.blobstores
+	ch <- c.blobstore_info
+}
+
+func (c *gwcConfigCollector) Collect(ch chan<- prometheus.Metric) {
+	path := c.resolvePath()
+	if path == "" {
+		// "auto" before the first successful home page scrape.
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	cfg, st, hash, err := c.file.load(path)
+	if err != nil {
+		log.Printf("gwc config: cannot load path=%q err=%v", path, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.last_modified, prometheus.GaugeValue, float64(st.ModTime().Unix()))
+	ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, cfg.Version, hash)
+
+	defaultStore := ""
+	for _, b := range cfg.BlobStores.Items {
+		if b.isDefault() {
+			defaultStore = b.ID
+		}
+	}
+
+	// A hand-edited file can repeat a layer, gridset, format or blob store;
+	// only the first definition is exported so no series is sent twice.
+	layerNames, gridSubsets, formats := seriesSet{}, seriesSet{}, seriesSet{}
+	for _, l := range cfg.Layers.Items {
+		if !layerNames.add(l.Name) {
+			continue
+		}
+		store := l.BlobStoreID
+		if store == "" {
+			store = defaultStore
+		}
+		ch <- prometheus.MustNewConstMetric(c.layer_info, prometheus.GaugeValue, 1, l.Name, l.XMLName.Local, store, enabledString(l.Enabled))
+		for _, gs := range l.GridSubsets {
+			if gridSubsets.add(l.Name, gs.GridSetName) {
+				ch <- prometheus.MustNewConstMetric(c.layer_gridset_info, prometheus.GaugeValue, 1, l.Name, gs.GridSetName, gs.ZoomStart, gs.ZoomStop)
+			}
+		}
+		for _, f := range l.MimeFormats {
+			if formats.add(l.Name, f) {
+				ch <- prometheus.MustNewConstMetric(c.layer_format_info, prometheus.GaugeValue, 1, l.Name, f)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.layer_expire_seconds, prometheus.GaugeValue, float64(l.expireSeconds(0)), l.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.layers, prometheus.GaugeValue, float64(len(layerNames)))
+
+	gridsets := seriesSet{}
+	for _, gs := range cfg.GridSets {
+		if !gridsets.add(gs.Name) {
+			continue
+		}
+		srs := ""
+		if gs.SRS != "" {
+			srs = "EPSG:" + gs.SRS
+		}
+		ch <- prometheus.MustNewConstMetric(c.gridset_info, prometheus.GaugeValue, 1, gs.Name, srs, "false")
+	}
+	for _, gs := range builtinGridSets {
+		if gridsets.add(gs.name) {
+			ch <- prometheus.MustNewConstMetric(c.gridset_info, prometheus.GaugeValue, 1, gs.name, gs.srs, "true")
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.gridsets, prometheus.GaugeValue, float64(len(gridsets)))
+
+	stores := seriesSet{}
+	for _, b := range cfg.BlobStores.Items {
+		if stores.add(b.ID) {
+			ch <- prometheus.MustNewConstMetric(c.blobstore_info, prometheus.GaugeValue, 1, b.ID, b.XMLName.Local, enabledString(b.Enabled), strconv.FormatBool(b.isDefault()))
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.blobstores, prometheus.GaugeValue, float64(len(stores)))
+}
+
+// seriesSet remembers label value tuples that were already emitted.
+type seriesSet map[string]bool
+
+// add reports whether values were not seen before and remembers them.
+func (s seriesSet) add(values ...string) bool {
+	key := strings.Join(values, "\xff")
+	if s[key] {
+		return false
+	}
+	s[key] = true
+	return true
+}
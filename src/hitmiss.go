@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// hitMissTracker turns GWC's lifetime "Cache hit ratio" into hit and miss
+// counters. The estimate requests × ratio is rebuilt on every scrape and
+// only the growth since the previous scrape is added: new requests are split
+// into hits (the growth of the hit estimate, at most the new requests) and
+// misses (the rest), so hits + misses always equals the requests seen and
+// neither goes back when the rounded ratio dips. The counters keep rising
+// when GWC restarts and, with a state file, when the exporter restarts.
+type hitMissTracker struct {
+	state  *counterState // nil keeps the marks in memory only
+	target string
+
+	mu     sync.Mutex
+	loaded bool
+	hm     hitMissState
+}
+
+// hitMissState is the part of a hitMissTracker kept in the state file.
+type hitMissState struct {
+	Seen     bool    `json:"seen"`
+	Started  int64   `json:"started_seconds"`
+	Requests float64 `json:"requests"`  // page requests at the last scrape
+	HitsMark float64 `json:"hits_mark"` // hit estimate counted so far since the last GWC restart
+	Hits     float64 `json:"hits"`
+	Misses   float64 `json:"misses"`
+}
+
+func (t *hitMissTracker) observe(started int64, requests, hitPercent float64) (hits, misses float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.loaded && t.state != nil {
+		t.hm = t.state.hitMiss(t.target)
+	}
+	t.loaded = true
+	hm := &t.hm
+
+	restarted := hm.Seen && (requests < hm.Requests || (started != 0 && hm.Started != 0 && started != hm.Started))
+	if restarted {
+		hm.Requests, hm.HitsMark = 0, 0
+	}
+	newRequests := requests - hm.Requests
+	if !hm.Seen {
+		// The first scrape counts GWC's lifetime so far, like the page does.
+		newRequests = requests
+	}
+	newHits := math.Round(requests*hitPercent/100) - hm.HitsMark
+	newHits = math.Max(0, math.Min(newHits, newRequests))
+
+	hm.Hits += newHits
+	hm.Misses += newRequests - newHits
+	hm.HitsMark += newHits
+	hm.Requests = requests
+	hm.Seen = true
+	if started != 0 {
+		hm.Started = started
+	}
+	if t.state != nil {
+		t.state.setHitMiss(t.target, *hm)
+	}
+	return hm.Hits, hm.Misses
+}
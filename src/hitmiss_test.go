@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHitMissTrackerObserve(t *testing.T) {
+	type scrape struct {
+		started              int64
+		requests, percent    float64
+		wantHits, wantMisses float64
+	}
+	tests := []struct {
+		name    string
+		scrapes []scrape
+	}{
+		{
+			name: "rising",
+			scrapes: []scrape{
+				{100, 100, 50, 50, 50},
+				{100, 200, 75, 150, 50},
+			},
+		},
+		{
+			name: "ratio dips",
+			scrapes: []scrape{
+				{100, 100, 80, 80, 20},
+				{100, 110, 60, 80, 30},
+				{100, 200, 60, 120, 80},
+			},
+		},
+		{
+			// A hit estimate growing faster than the requests must not
+			// push hits + misses past them.
+			name: "hit estimate jumps",
+			scrapes: []scrape{
+				{100, 100, 10, 10, 90},
+				{100, 110, 90, 20, 90},
+				{100, 200, 90, 110, 90},
+			},
+		},
+		{
+			name: "restart by start time",
+			scrapes: []scrape{
+				{100, 100, 50, 50, 50},
+				{200, 40, 50, 70, 70},
+				{200, 80, 50, 90, 90},
+			},
+		},
+		{
+			name: "restart by requests going down",
+			scrapes: []scrape{
+				{0, 100, 50, 50, 50},
+				{0, 10, 100, 60, 50},
+			},
+		},
+		{
+			name: "no requests",
+			scrapes: []scrape{
+				{100, 0, 0, 0, 0},
+				{100, 0, 0, 0, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var tr hitMissTracker
+		for i, sc := range tt.scrapes {
+			hits, misses := tr.observe(sc.started, sc.requests, sc.percent)
+			if hits != sc.wantHits || misses != sc.wantMisses {
+				t.Errorf("%s, scrape %d: got %v hits, %v misses; want %v, %v", tt.name, i, hits, misses, sc.wantHits, sc.wantMisses)
+			}
+		}
+	}
+}
+
+// The marks survive an exporter restart through the state file.
+func TestHitMissTrackerStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	const target = "http://gwc:8080/geowebcache"
+	observe := func(s *counterState, tr *hitMissTracker, started int64, requests, percent float64) (float64, float64) {
+		hits, misses := tr.observe(started, requests, percent)
+		if _, _, err := s.observe(target, started, map[string]float64{"requests": requests}); err != nil {
+			t.Fatal(err)
+		}
+		return hits, misses
+	}
+
+	s, err := loadCounterState(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &hitMissTracker{state: s, target: target}
+	observe(s, tr, 100, 100, 50)
+	observe(s, tr, 200, 20, 50)
+
+	s, err = loadCounterState(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr = &hitMissTracker{state: s, target: target}
+	if hits, misses := observe(s, tr, 200, 60, 50); hits != 80 || misses != 80 {
+		t.Errorf("after reload got %v hits, %v misses; want 80, 80", hits, misses)
+	}
+
+	other := &hitMissTracker{state: s, target: "http://gwc-2:8080/geowebcache"}
+	if hits, misses := other.observe(100, 10, 50); hits != 5 || misses != 5 {
+		t.Errorf("new target got %v hits, %v misses; want 5, 5", hits, misses)
+	}
+}
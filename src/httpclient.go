@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// basicAuth holds optional HTTP basic auth credentials for a scrape target.
+// The password may come from a file (e.g. a mounted Kubernetes secret).
+type basicAuth struct {
+	username     string
+	password     string
+	passwordFile string
+}
+
+func (a basicAuth) apply(req *http.Request) error {
+	if a.username == "" {
+		return nil
+	}
+	password := a.password
+	if a.passwordFile != "" {
+		b, err := os.ReadFile(a.passwordFile)
+		if err != nil {
+			return fmt.Errorf("read password file: %w", err)
+		}
+		password = strings.TrimSpace(string(b))
+	}
+	req.SetBasicAuth(a.username, password)
+	return nil
+}
+
+// fetchURL GETs url with auth and returns the body of a 200 response.
+func fetchURL(ctx context.Context, url string, auth basicAuth) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(req, auth)
+}
+
+// postJSON POSTs a JSON body to url with auth and returns the body of a 200 response.
+func postJSON(ctx context.Context, url string, body []byte, auth basicAuth) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(req, auth)
+}
+
+func doRequest(req *http.Request, auth basicAuth) ([]byte, error) {
+	if err := auth.apply(req); err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 response status=%d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// jolokiaRead is one entry of a Jolokia bulk read request.
+type jolokiaRead struct {
+	Type      string `json:"type"`
+	MBean     string `json:"mbean"`
+	Attribute any    `json:"attribute,omitempty"` // string or []string
+	Path      string `json:"path,omitempty"`
+}
+
+type jolokiaResponse struct {
+	Status int             `json:"status"`
+	Value  json.RawMessage `json:"value"`
+	Error  string          `json:"error"`
+}
+
+// jolokiaExtra maps one MBean attribute to a gauge.
+type jolokiaExtra struct {
+	metric    string
+	mbean     string
+	attribute string
+	path      string
+	desc      *prometheus.Desc // label: mbean
+}
+
+// parseJolokiaExtra parses "metric=mbean;attribute[;path]".
+func parseJolokiaExtra(spec string) (jolokiaExtra, error) {
+	metric, rest, ok := strings.Cut(spec, "=")
+	parts := strings.Split(rest, ";")
+	if !ok || len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return jolokiaExtra{}, fmt.Errorf("invalid mbean mapping %q, want metric=mbean;attribute[;path]", spec)
+	}
+	if !metricNameRe.MatchString(metric) {
+		return jolokiaExtra{}, fmt.Errorf("invalid metric name %q in mbean mapping", metric)
+	}
+	e := jolokiaExtra{metric: metric, mbean: parts[0], attribute: parts[1]}
+	if len(parts) == 3 {
+		e.path = parts[2]
+	}
+	help := fmt.Sprintf("JMX %s %s via Jolokia.", e.mbean, strings.Trim(e.attribute+"/"+e.path, "/"))
+	e.desc = prometheus.NewDesc(metric, help, []string{"mbean"}, nil)
+	return e, nil
+}
+
+// jolokiaCollector reads JVM MBeans over Jolokia (JMX over HTTP), so heap, GC
+// and thread pressure of GWC are visible without a java agent in the image.
+type jolokiaCollector struct {
+	url     string
+	auth    basicAuth
+	timeout time.Duration
+	extras  []jolokiaExtra
+
+	up                     *prometheus.Desc
+	memory_used_bytes      *prometheus.Desc // label: area
+	memory_committed_bytes *prometheus.Desc // label: area
+	memory_max_bytes       *prometheus.Desc // label: area
+	gc_collections_total   *prometheus.Desc // label: gc
+	gc_collection_seconds  *prometheus.Desc // label: gc
+	threads_current        *prometheus.Desc
+	threads_daemon         *prometheus.Desc
+	threads_peak           *prometheus.Desc
+	threads_started_total  *prometheus.Desc
+	classes_loaded_current *prometheus.Desc
+	classes_loaded_total   *prometheus.Desc
+	classes_unloaded_total *prometheus.Desc
+}
+
+func newJolokiaCollector(url string, auth basicAuth, timeout time.Duration, extraSpecs []string) (*jolokiaCollector, error) {
+	const ns = "gwc_jvm"
+	c := &jolokiaCollector{
+		url:     url,
+		auth:    auth,
+		timeout: timeout,
+
+		up:                     prometheus.NewDesc("gwc_jolokia_up", "Was the last Jolokia read successful.", nil, nil),
+		memory_used_bytes:      prometheus.NewDesc(ns+"_memory_used_bytes", "Used JVM memory.", []string{"area"}, nil),
+		memory_committed_bytes: prometheus.NewDesc(ns+"_memory_committed_bytes", "Committed JVM memory.", []string{"area"}, nil),
+		memory_max_bytes:       prometheus.NewDesc(ns+"_memory_max_bytes", "Maximum JVM memory (-1 if undefined).", []string{"area"}, nil),
+		gc_collections_total:   prometheus.NewDesc(ns+"_gc_collections_total", "Garbage collections.", []string{"gc"}, nil),
+		gc_collection_seconds:  prometheus.NewDesc(ns+"_gc_collection_seconds_total", "Time spent in garbage collection.", []string{"gc"}, nil),
+		threads_current:        prometheus.NewDesc(ns+"_threads_current", "Current live threads.", nil, nil),
+		threads_daemon:         prometheus.NewDesc(ns+"_threads_daemon", "Current live daemon threads.", nil, nil),
+		threads_peak:           prometheus.NewDesc(ns+"_threads_peak", "Peak live threads since JVM start.", nil, nil),
+		threads_started_total:  prometheus.NewDesc(ns+"_threads_started_total", "Threads started since JVM start.", nil, nil),
+		classes_loaded_current: prometheus.NewDesc(ns+"_classes_loaded_current", "Currently loaded classes.", nil, nil),
+		classes_loaded_total:   prometheus.NewDesc(ns+"_classes_loaded_total", "Classes loaded since JVM start.", nil, nil),
+		classes_unloaded_total: prometheus.NewDesc(ns+"_classes_unloaded_total", "Classes unloaded since JVM start.", nil, nil),
+	}
+	for _, spec := range extraSpecs {
+		e, err := parseJolokiaExtra(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.extras = append(c.extras, e)
+	}
+	return c, nil
+}
+
+func (c *jolokiaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.memory_used_bytes
+	ch <- c.memory_committed_bytes
+	ch <- c.memory_max_bytes
+	ch <- c.gc_collections_total
+	ch <- c.gc_collection_seconds
+	ch <- c.threads_current
+	ch <- c.threads_daemon
+	ch <- c.threads_peak
+	ch <- c.threads_started_total
+	ch <- c.classes_loaded_current
+	ch <- c.classes_loaded_total
+	ch <- c.classes_unloaded_total
+	for _, e := range c.extras {
+		ch <- e.desc
+	}
+}
+
+// Fixed positions of the built-in reads in the bulk request.
+const (
+	jolokiaReadMemory = iota
+	jolokiaReadGC
+	jolokiaReadThreading
+	jolokiaReadClassLoading
+	jolokiaBuiltinReads
+)
+
+func (c *jolokiaCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	reads := []jolokiaRead{
+		jolokiaReadMemory:       {Type: "read", MBean: "java.lang:type=Memory", Attribute: []string{"HeapMemoryUsage", "NonHeapMemoryUsage"}},
+		jolokiaReadGC:           {Type: "read", MBean: "java.lang:type=GarbageCollector,name=*", Attribute: []string{"CollectionCount", "CollectionTime"}},
+		jolokiaReadThreading:    {Type: "read", MBean: "java.lang:type=Threading", Attribute: []string{"ThreadCount", "DaemonThreadCount", "PeakThreadCount", "TotalStartedThreadCount"}},
+		jolokiaReadClassLoading: {Type: "read", MBean: "java.lang:type=ClassLoading", Attribute: []string{"LoadedClassCount", "TotalLoadedClassCount", "UnloadedClassCount"}},
+	}
+	for _, e := range c.extras {
+		reads = append(reads, jolokiaRead{Type: "read", MBean: e.mbean, Attribute: e.attribute, Path: e.path})
+	}
+
+	reqBody, _ := json.Marshal(reads)
+	body, err := postJSON(ctx, c.url, reqBody, c.auth)
+	if err != nil {
+		log.Printf("jolokia scrape: request failed target=%q err=%v", c.url, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	var resps []jolokiaResponse
+	if err := json.Unmarshal(body, &resps); err != nil || len(resps) != len(reads) {
+		log.Printf("jolokia scrape: unexpected response target=%q err=%v", c.url, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	for i, r := range resps {
+		if r.Status != 200 {
+			log.Printf("jolokia scrape: read failed mbean=%q status=%d err=%s", reads[i].MBean, r.Status, r.Error)
+		}
+	}
+
+	// Memory
+	var mem map[string]struct {
+		Used      float64 `json:"used"`
+		Committed float64 `json:"committed"`
+		Max       float64 `json:"max"`
+	}
+	if resps[jolokiaReadMemory].Status == 200 && json.Unmarshal(resps[jolokiaReadMemory].Value, &mem) == nil {
+		for attr, area := range map[string]string{"HeapMemoryUsage": "heap", "NonHeapMemoryUsage": "nonheap"} {
+			if u, ok := mem[attr]; ok {
+				ch <- prometheus.MustNewConstMetric(c.memory_used_bytes, prometheus.GaugeValue, u.Used, area)
+				ch <- prometheus.MustNewConstMetric(c.memory_committed_bytes, prometheus.GaugeValue, u.Committed, area)
+				ch <- prometheus.MustNewConstMetric(c.memory_max_bytes, prometheus.GaugeValue, u.Max, area)
+			}
+		}
+	}
+
+	// GC (pattern read: mbean name -> attributes)
+	var gcs map[string]map[string]float64
+	if resps[jolokiaReadGC].Status == 200 && json.Unmarshal(resps[jolokiaReadGC].Value, &gcs) == nil {
+		for mbean, attrs := range gcs {
+			name := mbeanProperty(mbean, "name")
+			ch <- prometheus.MustNewConstMetric(c.gc_collections_total, prometheus.CounterValue, attrs["CollectionCount"], name)
+			ch <- prometheus.MustNewConstMetric(c.gc_collection_seconds, prometheus.CounterValue, attrs["CollectionTime"]/1000, name)
+		}
+	}
+
+	var threads map[string]float64
+	if resps[jolokiaReadThreading].Status == 200 && json.Unmarshal(resps[jolokiaReadThreading].Value, &threads) == nil {
+		ch <- prometheus.MustNewConstMetric(c.threads_current, prometheus.GaugeValue, threads["ThreadCount"])
+		ch <- prometheus.MustNewConstMetric(c.threads_daemon, prometheus.GaugeValue, threads["DaemonThreadCount"])
+		ch <- prometheus.MustNewConstMetric(c.threads_peak, prometheus.GaugeValue, threads["PeakThreadCount"])
+		ch <- prometheus.MustNewConstMetric(c.threads_started_total, prometheus.CounterValue, threads["TotalStartedThreadCount"])
+	}
+
+	var classes map[string]float64
+	if resps[jolokiaReadClassLoading].Status == 200 && json.Unmarshal(resps[jolokiaReadClassLoading].Value, &classes) == nil {
+		ch <- prometheus.MustNewConstMetric(c.classes_loaded_current, prometheus.GaugeValue, classes["LoadedClassCount"])
+		ch <- prometheus.MustNewConstMetric(c.classes_loaded_total, prometheus.CounterValue, classes["TotalLoadedClassCount"])
+		ch <- prometheus.MustNewConstMetric(c.classes_unloaded_total, prometheus.CounterValue, classes["UnloadedClassCount"])
+	}
+
+	for i, e := range c.extras {
+		r := resps[jolokiaBuiltinReads+i]
+		if r.Status != 200 {
+			continue
+		}
+		for mbean, v := range jolokiaExtraValues(e, r.Value) {
+			ch <- prometheus.MustNewConstMetric(e.desc, prometheus.GaugeValue, v, mbean)
+		}
+	}
+}
+
+// jolokiaExtraValues flattens the value of a single-attribute read. Plain
+// reads return the (path-resolved) value itself; wildcard reads return
+// {"mbean": {"Attr": v}}.
+func jolokiaExtraValues(e jolokiaExtra, raw json.RawMessage) map[string]float64 {
+	out := map[string]float64{}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return out
+	}
+	if !strings.Contains(e.mbean, "*") {
+		if n, ok := jolokiaNumber(v); ok {
+			out[e.mbean] = n
+		}
+		return out
+	}
+	byMBean, _ := v.(map[string]any)
+	for mbean, attrs := range byMBean {
+		if m, ok := attrs.(map[string]any); ok {
+			if n, ok := jolokiaNumber(m[e.attribute]); ok {
+				out[mbean] = n
+			}
+		}
+	}
+	return out
+}
+
+func jolokiaNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// mbeanProperty returns a key property of an ObjectName, e.g. name from
+// "java.lang:name=G1 Young Generation,type=GarbageCollector".
+func mbeanProperty(objectName, key string) string {
+	_, props, _ := strings.Cut(objectName, ":")
+	for _, kv := range strings.Split(props, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return objectName
+}
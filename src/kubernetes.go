@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kubePod is the part of a Pod object the discovery needs.
+type kubePod struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		Namespace         string            `json:"namespace"`
+		Labels            map[string]string `json:"labels"`
+		Annotations       map[string]string `json:"annotations"`
+		DeletionTimestamp *string           `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Ports []struct {
+				Name          string `json:"name"`
+				ContainerPort int    `json:"containerPort"`
+			} `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string `json:"phase"`
+		PodIP      string `json:"podIP"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// ready reports whether the pod's Ready condition is true, i.e. it passes its
+// readiness probe and would receive Service traffic.
+func (p kubePod) ready() bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+// podClient lists and watches pods. kubeAPI talks to the API server; tests
+// and dry runs can plug in a fake that serves pods from memory.
+type podClient interface {
+	// listPods returns the pods of namespace ("" for all) matching selector
+	// and the resourceVersion to watch from.
+	listPods(ctx context.Context, namespace, selector string) ([]kubePod, string, error)
+	// watchPods calls handle for every change after resourceVersion until the
+	// watch ends. It returns errWatchExpired when a fresh list is needed.
+	watchPods(ctx context.Context, namespace, selector, resourceVersion string, handle func(eventType string, pod kubePod)) error
+}
+
+var errWatchExpired = errors.New("watch expired")
+
+// kubernetesSource discovers GWC pods. Running, ready pods with an IP and a
+// container port named portName become targets; the home page path comes
+// from the pathAnnotation of the pod, else defaultPath. Series get pod,
+// namespace and node labels.
+type kubernetesSource struct {
+	client         podClient
+	namespaces     []string // empty watches all namespaces
+	selector       string
+	portName       string
+	pathAnnotation string
+	defaultPath    string
+
+	mu   sync.Mutex
+	pods map[string]map[string]kubePod // namespace watch -> namespace/name -> pod
+}
+
+func newKubernetesSource(client podClient, namespaces []string, selector, portName, pathAnnotation, defaultPath string) *kubernetesSource {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	return &kubernetesSource{
+		client:         client,
+		namespaces:     namespaces,
+		selector:       selector,
+		portName:       portName,
+		pathAnnotation: pathAnnotation,
+		defaultPath:    defaultPath,
+		pods:           map[string]map[string]kubePod{},
+	}
+}
+
+func (s *kubernetesSource) run(ctx context.Context, update func([]target)) {
+	for _, ns := range s.namespaces {
+		go s.watch(ctx, ns, update)
+	}
+}
+
+// watch lists the pods of one namespace and follows changes, listing again
+// whenever the watch expires or fails.
+func (s *kubernetesSource) watch(ctx context.Context, ns string, update func([]target)) {
+	for {
+		pods, rv, err := s.client.listPods(ctx, ns, s.selector)
+		if err != nil {
+			log.Printf("kubernetes discovery: list pods failed namespace=%q err=%v", ns, err)
+		} else {
+			current := map[string]kubePod{}
+			for _, p := range pods {
+				current[p.Metadata.Namespace+"/"+p.Metadata.Name] = p
+			}
+			s.mu.Lock()
+			s.pods[ns] = current
+			s.mu.Unlock()
+			update(s.targets())
+
+			err = s.client.watchPods(ctx, ns, s.selector, rv, func(eventType string, p kubePod) {
+				key := p.Metadata.Namespace + "/" + p.Metadata.Name
+				s.mu.Lock()
+				switch eventType {
+				case "ADDED", "MODIFIED":
+					s.pods[ns][key] = p
+				case "DELETED":
+					delete(s.pods[ns], key)
+				}
+				s.mu.Unlock()
+				update(s.targets())
+			})
+			if err == nil || errors.Is(err, errWatchExpired) {
+				continue
+			}
+			log.Printf("kubernetes discovery: watch pods failed namespace=%q err=%v", ns, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// targets builds the current target list from all watched namespaces.
+func (s *kubernetesSource) targets() []target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []target
+	for _, pods := range s.pods {
+		for _, p := range pods {
+			if t, ok := s.podTarget(p); ok {
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].url < out[j].url })
+	return out
+}
+
+func (s *kubernetesSource) podTarget(p kubePod) (target, bool) {
+	if p.Status.Phase != "Running" || !p.ready() || p.Status.PodIP == "" || p.Metadata.DeletionTimestamp != nil {
+		return target{}, false
+	}
+	port := 0
+	for _, c := range p.Spec.Containers {
+		for _, cp := range c.Ports {
+			if cp.Name == s.portName {
+				port = cp.ContainerPort
+			}
+		}
+	}
+	if port == 0 {
+		return target{}, false
+	}
+	path := s.defaultPath
+	if v := p.Metadata.Annotations[s.pathAnnotation]; v != "" {
+		path = v
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return target{
+		url: "http://" + net.JoinHostPort(p.Status.PodIP, strconv.Itoa(port)) + path,
+		labels: map[string]string{
+			"pod":       p.Metadata.Name,
+			"namespace": p.Metadata.Namespace,
+			"node":      p.Spec.NodeName,
+		},
+	}, true
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeAPI is a podClient for the Kubernetes API server. Inside a pod it uses
+// the service account token and CA; with an explicit server URL (e.g. from
+// kubectl proxy) no credentials are sent.
+type kubeAPI struct {
+	server    string
+	tokenFile string
+	client    *http.Client
+}
+
+func newKubeAPI(server string) (*kubeAPI, error) {
+	if server != "" {
+		return &kubeAPI{server: strings.TrimRight(server, "/"), client: &http.Client{}}, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster (KUBERNETES_SERVICE_HOST unset) and no API server given")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in service account ca.crt")
+	}
+	return &kubeAPI{
+		server:    "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}},
+	}, nil
+}
+
+func (k *kubeAPI) podsURL(namespace string, query url.Values) string {
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	}
+	return k.server + path + "?" + query.Encode()
+}
+
+func (k *kubeAPI) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if k.tokenFile != "" {
+		// Projected tokens are rotated, so read the file on every request.
+		token, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			return nil, errWatchExpired
+		}
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+func (k *kubeAPI) listPods(ctx context.Context, namespace, selector string) ([]kubePod, string, error) {
+	q := url.Values{}
+	if selector != "" {
+		q.Set("labelSelector", selector)
+	}
+	resp, err := k.get(ctx, k.podsURL(namespace, q))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []kubePod `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", err
+	}
+	return list.Items, list.Metadata.ResourceVersion, nil
+}
+
+func (k *kubeAPI) watchPods(ctx context.Context, namespace, selector, resourceVersion string, handle func(string, kubePod)) error {
+	q := url.Values{}
+	q.Set("watch", "1")
+	q.Set("resourceVersion", resourceVersion)
+	q.Set("allowWatchBookmarks", "true")
+	q.Set("timeoutSeconds", "300")
+	if selector != "" {
+		q.Set("labelSelector", selector)
+	}
+	resp, err := k.get(ctx, k.podsURL(namespace, q))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil // server-side timeout; list again
+			}
+			return err
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			var p kubePod
+			if err := json.Unmarshal(ev.Object, &p); err != nil {
+				return err
+			}
+			handle(ev.Type, p)
+		case "ERROR":
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(ev.Object, &status)
+			if status.Code == http.StatusGone {
+				return errWatchExpired
+			}
+			return fmt.Errorf("watch error %d: %s", status.Code, status.Message)
+		}
+	}
+}
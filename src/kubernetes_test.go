@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePods is an in-memory podClient. listPods serves pods; watchPods replays
+// the events sent on events and returns errWatchExpired for an expire event.
+type fakePods struct {
+	events chan fakePodEvent
+
+	mu    sync.Mutex
+	pods  []kubePod
+	lists int
+}
+
+type fakePodEvent struct {
+	typ    string // ADDED, MODIFIED, DELETED, or "" to expire the watch
+	pod    kubePod
+	handle chan struct{} // closed once the event was handled
+}
+
+func (f *fakePods) listPods(ctx context.Context, namespace, selector string) ([]kubePod, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists++
+	return append([]kubePod(nil), f.pods...), "1", nil
+}
+
+func (f *fakePods) watchPods(ctx context.Context, namespace, selector, resourceVersion string, handle func(string, kubePod)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-f.events:
+			if ev.typ == "" {
+				close(ev.handle)
+				return errWatchExpired
+			}
+			handle(ev.typ, ev.pod)
+			close(ev.handle)
+		}
+	}
+}
+
+func (f *fakePods) setPods(pods ...kubePod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pods = pods
+}
+
+func testPod(name, ip string) kubePod {
+	var p kubePod
+	p.Metadata.Name = name
+	p.Metadata.Namespace = "gwc"
+	p.Spec.NodeName = "node-1"
+	p.Spec.Containers = make([]struct {
+		Ports []struct {
+			Name          string `json:"name"`
+			ContainerPort int    `json:"containerPort"`
+		} `json:"ports"`
+	}, 1)
+	p.Spec.Containers[0].Ports = append(p.Spec.Containers[0].Ports, struct {
+		Name          string `json:"name"`
+		ContainerPort int    `json:"containerPort"`
+	}{Name: "http", ContainerPort: 8080})
+	p.Status.Phase = "Running"
+	p.Status.PodIP = ip
+	p.Status.Conditions = append(p.Status.Conditions, struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}{Type: "Ready", Status: "True"})
+	return p
+}
+
+func TestKubernetesPodTarget(t *testing.T) {
+	s := newKubernetesSource(nil, nil, "", "http", "gwc-exporter/path", "/geowebcache")
+	deleted := "2026-10-06T08:00:00Z"
+
+	tests := []struct {
+		name   string
+		modify func(p *kubePod)
+		want   string // "" for no target
+	}{
+		{"running", func(p *kubePod) {}, "http://10.0.0.1:8080/geowebcache"},
+		{"pending", func(p *kubePod) { p.Status.Phase = "Pending" }, ""},
+		{"no ip", func(p *kubePod) { p.Status.PodIP = "" }, ""},
+		{"terminating", func(p *kubePod) { p.Metadata.DeletionTimestamp = &deleted }, ""},
+		{"not ready", func(p *kubePod) { p.Status.Conditions[0].Status = "False" }, ""},
+		{"no conditions", func(p *kubePod) { p.Status.Conditions = nil }, ""},
+		{"other port name", func(p *kubePod) { p.Spec.Containers[0].Ports[0].Name = "admin" }, ""},
+		{"no ports", func(p *kubePod) { p.Spec.Containers[0].Ports = nil }, ""},
+		{"path annotation", func(p *kubePod) {
+			p.Metadata.Annotations = map[string]string{"gwc-exporter/path": "gwc/home"}
+		}, "http://10.0.0.1:8080/gwc/home"},
+		{"ipv6", func(p *kubePod) { p.Status.PodIP = "fd00::1" }, "http://[fd00::1]:8080/geowebcache"},
+	}
+	for _, tt := range tests {
+		p := testPod("gwc-0", "10.0.0.1")
+		tt.modify(&p)
+		got, ok := s.podTarget(p)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s: got target %q, want none", tt.name, got.url)
+			}
+			continue
+		}
+		if !ok || got.url != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.name, got.url, ok, tt.want)
+		}
+	}
+
+	got, _ := s.podTarget(testPod("gwc-0", "10.0.0.1"))
+	want := map[string]string{"pod": "gwc-0", "namespace": "gwc", "node": "node-1"}
+	if !reflect.DeepEqual(got.labels, want) {
+		t.Errorf("labels = %v, want %v", got.labels, want)
+	}
+	if err := checkTargetLabels(got.labels); err != nil {
+		t.Errorf("pod labels rejected: %v", err)
+	}
+}
+
+func TestKubernetesSourceWatch(t *testing.T) {
+	f := &fakePods{events: make(chan fakePodEvent)}
+	f.setPods(testPod("gwc-0", "10.0.0.1"))
+	s := newKubernetesSource(f, []string{"gwc"}, "app=gwc", "http", "gwc-exporter/path", "/geowebcache")
+
+	updates := make(chan []string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.run(ctx, func(ts []target) {
+		var urls []string
+		for _, t := range ts {
+			urls = append(urls, t.url)
+		}
+		updates <- urls
+	})
+
+	expect := func(step string, want ...string) {
+		t.Helper()
+		select {
+		case got := <-updates:
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: targets %v, want %v", step, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no update", step)
+		}
+	}
+	send := func(typ string, p kubePod) {
+		t.Helper()
+		ev := fakePodEvent{typ: typ, pod: p, handle: make(chan struct{})}
+		f.events <- ev
+		<-ev.handle
+	}
+
+	expect("list", "http://10.0.0.1:8080/geowebcache")
+
+	send("ADDED", testPod("gwc-1", "10.0.0.2"))
+	expect("added", "http://10.0.0.1:8080/geowebcache", "http://10.0.0.2:8080/geowebcache")
+
+	notReady := testPod("gwc-1", "10.0.0.2")
+	notReady.Status.Conditions[0].Status = "False"
+	send("MODIFIED", notReady)
+	expect("modified", "http://10.0.0.1:8080/geowebcache")
+
+	send("DELETED", testPod("gwc-0", "10.0.0.1"))
+	expect("deleted")
+
+	// An expired watch (410 Gone) lists again and replaces all pods.
+	f.setPods(testPod("gwc-2", "10.0.0.3"))
+	send("", kubePod{})
+	expect("relist", "http://10.0.0.3:8080/geowebcache")
+	f.mu.Lock()
+	lists := f.lists
+	f.mu.Unlock()
+	if lists != 2 {
+		t.Errorf("listed %d times, want 2", lists)
+	}
+}
+
+func TestKubeAPIWatchExpired(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/gwc/pods", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("labelSelector") != "app=gwc" {
+			http.Error(w, "missing selector", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case q.Get("watch") == "":
+			_, _ = w.Write([]byte(`{"metadata":{"resourceVersion":"7"},"items":[{"metadata":{"name":"gwc-0","namespace":"gwc"},"status":{"phase":"Running","podIP":"10.0.0.1","conditions":[{"type":"Ready","status":"True"}]}}]}`))
+		case q.Get("resourceVersion") == "7":
+			_, _ = w.Write([]byte(`{"type":"MODIFIED","object":{"metadata":{"name":"gwc-0","namespace":"gwc"}}}` + "\n" +
+				`{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}` + "\n"))
+		default:
+			http.Error(w, `{"kind":"Status","code":410}`, http.StatusGone)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	k, err := newKubeAPI(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	pods, rv, err := k.listPods(ctx, "gwc", "app=gwc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv != "7" || len(pods) != 1 || !pods[0].ready() || pods[0].Status.PodIP != "10.0.0.1" {
+		t.Fatalf("list = %+v, %q", pods, rv)
+	}
+
+	var events []string
+	err = k.watchPods(ctx, "gwc", "app=gwc", rv, func(typ string, p kubePod) { events = append(events, typ+" "+p.Metadata.Name) })
+	if !errors.Is(err, errWatchExpired) {
+		t.Errorf("ERROR 410 event: err = %v, want errWatchExpired", err)
+	}
+	if !reflect.DeepEqual(events, []string{"MODIFIED gwc-0"}) {
+		t.Errorf("events = %v", events)
+	}
+
+	if err := k.watchPods(ctx, "gwc", "app=gwc", "1", func(string, kubePod) {}); !errors.Is(err, errWatchExpired) {
+		t.Errorf("HTTP 410: err = %v, want errWatchExpired", err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	_ "modernc.org/sqlite" // pure Go driver, keeps CGO_ENABLED=0 builds
+)
+
+type mbtilesZoomStats struct {
+	zoom  string
+	tiles float64
+	bytes float64
+}
+
+type mbtilesFileStats struct {
+	path    string
+	ok      bool
+	size    float64
+	walSize float64
+	zooms   []mbtilesZoomStats
+}
+
+// mbtilesCollector inspects GWC's MBTiles/SQLite blob store files, which the
+// file blob store directory walk cannot see into. Files are opened read-only
+// and scanned in the background; scrapes return the last scan.
+type mbtilesCollector struct {
+	paths    []string // files, directories or globs; "config" = blob store roots from geowebcache.xml
+	config   func() *gwcConfig
+	interval time.Duration
+
+	mu       sync.Mutex
+	files    []mbtilesFileStats
+	lastScan time.Time
+	duration time.Duration
+
+	file_up        *prometheus.Desc // label: file
+	file_size      *prometheus.Desc // label: file
+	wal_size       *prometheus.Desc // label: file
+	tiles          *prometheus.Desc // labels: file, zoom
+	tiles_bytes    *prometheus.Desc // labels: file, zoom
+	files_total    *prometheus.Desc
+	scan_duration  *prometheus.Desc
+	scan_timestamp *prometheus.Desc
+}
+
+func newMbtilesCollector(paths []string, config func() *gwcConfig, interval time.Duration) *mbtilesCollector {
+	const ns = "gwc_mbtiles"
+	return &mbtilesCollector{
+		paths:    paths,
+		config:   config,
+		interval: interval,
+
+		file_up:        prometheus.NewDesc(ns+"_file_up", "1 if the MBTiles/SQLite file could be read in the last scan, else 0.", []string{"file"}, nil),
+		file_size:      prometheus.NewDesc(ns+"_file_size_bytes", "Size of the MBTiles/SQLite file.", []string{"file"}, nil),
+		wal_size:       prometheus.NewDesc(ns+"_wal_size_bytes", "Size of the write-ahead log next to the file (0 if none).", []string{"file"}, nil),
+		tiles:          prometheus.NewDesc(ns+"_tiles", "Tiles stored in the file per zoom level.", []string{"file", "zoom"}, nil),
+		tiles_bytes:    prometheus.NewDesc(ns+"_tiles_bytes", "Total tile blob size in the file per zoom level.", []string{"file", "zoom"}, nil),
+		files_total:    prometheus.NewDesc(ns+"_files", "MBTiles/SQLite files found in the last scan.", nil, nil),
+		scan_duration:  prometheus.NewDesc(ns+"_scan_duration_seconds", "Duration of the last MBTiles scan.", nil, nil),
+		scan_timestamp: prometheus.NewDesc(ns+"_last_scan_timestamp_seconds", "Unix time the last MBTiles scan finished.", nil, nil),
+	}
+}
+
+func (c *mbtilesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.file_up
+	ch <- c.file_size
+	ch <- c.wal_size
+	ch <- c.tiles
+	ch <- c.tiles_bytes
+	ch <- c.files_total
+	ch <- c.scan_duration
+	ch <- c.scan_timestamp
+}
+
+func (c *mbtilesCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastScan.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.files_total, prometheus.GaugeValue, float64(len(c.files)))
+	ch <- prometheus.MustNewConstMetric(c.scan_duration, prometheus.GaugeValue, c.duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.scan_timestamp, prometheus.GaugeValue, float64(c.lastScan.Unix()))
+	for _, f := range c.files {
+		up := 0.0
+		if f.ok {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.file_up, prometheus.GaugeValue, up, f.path)
+		ch <- prometheus.MustNewConstMetric(c.file_size, prometheus.GaugeValue, f.size, f.path)
+		ch <- prometheus.MustNewConstMetric(c.wal_size, prometheus.GaugeValue, f.walSize, f.path)
+		for _, z := range f.zooms {
+			ch <- prometheus.MustNewConstMetric(c.tiles, prometheus.GaugeValue, z.tiles, f.path, z.zoom)
+			ch <- prometheus.MustNewConstMetric(c.tiles_bytes, prometheus.GaugeValue, z.bytes, f.path, z.zoom)
+		}
+	}
+}
+
+func (c *mbtilesCollector) run(ctx context.Context) {
+	for {
+		c.scan(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+func (c *mbtilesCollector) scan(ctx context.Context) {
+	start := time.Now()
+	var files []mbtilesFileStats
+	for _, path := range c.findFiles() {
+		if ctx.Err() != nil {
+			return
+		}
+		files = append(files, readMbtilesFile(ctx, path))
+	}
+	c.mu.Lock()
+	c.files = files
+	c.lastScan = time.Now()
+	c.duration = time.Since(start)
+	c.mu.Unlock()
+}
+
+// findFiles expands the configured paths into a sorted, de-duplicated file list.
+func (c *mbtilesCollector) findFiles() []string {
+	var roots []string
+	for _, p := range c.paths {
+		if p != "config" {
+			roots = append(roots, p)
+			continue
+		}
+		cfg := c.config()
+		if cfg == nil {
+			continue
+		}
+		for _, b := range cfg.BlobStores.Items {
+			if b.RootDirectory != "" && enabledString(b.Enabled) == "true" {
+				roots = append(roots, b.RootDirectory)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var out []string
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, root := range roots {
+		matches, err := filepath.Glob(root)
+		if err != nil {
+			log.Printf("mbtiles: invalid path pattern=%q err=%v", root, err)
+			continue
+		}
+		for _, m := range matches {
+			st, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+			if !st.IsDir() {
+				add(m)
+				continue
+			}
+			_ = filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && isMbtilesFile(p) {
+					add(p)
+				}
+				return nil
+			})
+		}
+	}
+	return out
+}
+
+func isMbtilesFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".mbtiles", ".sqlite", ".sqlite3", ".db":
+		return true
+	}
+	return false
+}
+
+func readMbtilesFile(ctx context.Context, path string) mbtilesFileStats {
+	f := mbtilesFileStats{path: path}
+	if st, err := os.Stat(path); err == nil {
+		f.size = float64(st.Size())
+	}
+	if st, err := os.Stat(path + "-wal"); err == nil {
+		f.walSize = float64(st.Size())
+	}
+
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		log.Printf("mbtiles: cannot open file=%q err=%v", path, err)
+		return f
+	}
+	defer db.Close()
+
+	// length() takes the blob size from the record header without reading it.
+	rows, err := db.QueryContext(ctx, `SELECT zoom_level, COUNT(*), COALESCE(SUM(LENGTH(tile_data)), 0) FROM tiles GROUP BY zoom_level ORDER BY zoom_level`)
+	if err != nil {
+		log.Printf("mbtiles: query failed file=%q err=%v", path, err)
+		return f
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			zoom         int64
+			tiles, bytes float64
+		)
+		if err := rows.Scan(&zoom, &tiles, &bytes); err != nil {
+			log.Printf("mbtiles: scan failed file=%q err=%v", path, err)
+			return f
+		}
+		f.zooms = append(f.zooms, mbtilesZoomStats{zoom: strconv.FormatInt(zoom, 10), tiles: tiles, bytes: bytes})
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("mbtiles: query failed file=%q err=%v", path, err)
+		return f
+	}
+	f.ok = true
+	return f
+}
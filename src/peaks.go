@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// peakEvent is a new peak seen between two scrapes.
+type peakEvent struct {
+	Target        string    `json:"target"`
+	Kind          string    `json:"kind"` // request_rate or bandwidth
+	Value         float64   `json:"value"`
+	Unit          string    `json:"unit"`
+	Time          time.Time `json:"time"`
+	PreviousValue float64   `json:"previous_value"`
+	PreviousTime  time.Time `json:"previous_time"`
+	ObservedAt    time.Time `json:"observed_at"`
+}
+
+type peakMark struct {
+	value float64
+	ts    int64
+	seen  time.Time // last observe, for pruning
+}
+
+// peakTracker turns GWC's peak high-water marks into events: whenever the
+// timestamp of a peak changes between scrapes a new peak was set (or GWC
+// restarted and set its first one). The newest events are kept in memory
+// and served as JSON so peaks can be lined up with campaigns or incidents.
+// Marks of targets not observed for retention are dropped.
+type peakTracker struct {
+	limit     int           // events kept; 0 keeps none
+	logEvents bool          // log every event as a key=value line
+	retention time.Duration // 0 keeps marks forever
+
+	mu      sync.Mutex
+	last    map[string]peakMark // target + kind
+	history []peakEvent
+}
+
+func newPeakTracker(limit int, logEvents bool, retention time.Duration) *peakTracker {
+	return &peakTracker{limit: limit, logEvents: logEvents, retention: retention, last: map[string]peakMark{}}
+}
+
+// observe compares a peak from the page with the previous scrape and reports
+// whether it is a new one. The first scrape only sets the baseline.
+func (t *peakTracker) observe(target, kind, unit string, value float64, ts int64, now time.Time) bool {
+	if ts <= 0 || value < 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.retention > 0 {
+		for key, m := range t.last {
+			if now.Sub(m.seen) > t.retention {
+				delete(t.last, key)
+			}
+		}
+	}
+	key := target + " " + kind
+	prev, seen := t.last[key]
+	t.last[key] = peakMark{value, ts, now}
+	if !seen || prev.ts == ts {
+		return false
+	}
+
+	ev := peakEvent{
+		Target:        target,
+		Kind:          kind,
+		Value:         value,
+		Unit:          unit,
+		Time:          time.Unix(ts, 0).UTC(),
+		PreviousValue: prev.value,
+		PreviousTime:  time.Unix(prev.ts, 0).UTC(),
+		ObservedAt:    now.UTC(),
+	}
+	if t.limit > 0 {
+		t.history = append(t.history, ev)
+		if len(t.history) > t.limit {
+			t.history = append(t.history[:0:0], t.history[len(t.history)-t.limit:]...)
+		}
+	}
+	if t.logEvents {
+		log.Printf("peak event: target=%q kind=%s value=%g unit=%s time=%s previous_value=%g previous_time=%s",
+			ev.Target, ev.Kind, ev.Value, ev.Unit, ev.Time.Format(time.RFC3339), ev.PreviousValue, ev.PreviousTime.Format(time.RFC3339))
+	}
+	return true
+}
+
+// ServeHTTP lists the kept events, oldest first.
+func (t *peakTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	t.mu.Lock()
+	events := append([]peakEvent{}, t.history...)
+	t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Events []peakEvent `json:"events"`
+	}{events})
+}
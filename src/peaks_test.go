@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPeakTrackerObserve(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	type scrape struct {
+		target, kind string
+		value        float64
+		ts           int64
+		want         bool
+	}
+	tests := []struct {
+		name    string
+		scrapes []scrape
+	}{
+		{
+			name: "baseline then new peak",
+			scrapes: []scrape{
+				{"a", "request_rate", 10, 100, false},
+				{"a", "request_rate", 10, 100, false},
+				{"a", "request_rate", 25, 200, true},
+				{"a", "request_rate", 25, 200, false},
+			},
+		},
+		{
+			// GWC restarting sets a lower first peak with a new timestamp.
+			name: "restart",
+			scrapes: []scrape{
+				{"a", "bandwidth", 50, 100, false},
+				{"a", "bandwidth", 5, 300, true},
+			},
+		},
+		{
+			name: "kinds and targets are separate",
+			scrapes: []scrape{
+				{"a", "request_rate", 10, 100, false},
+				{"a", "bandwidth", 10, 200, false},
+				{"b", "request_rate", 10, 300, false},
+				{"a", "request_rate", 10, 300, true},
+			},
+		},
+		{
+			name: "missing peak",
+			scrapes: []scrape{
+				{"a", "request_rate", 10, 0, false},
+				{"a", "request_rate", -1, 100, false},
+				{"a", "request_rate", 10, 100, false},
+				{"a", "request_rate", 10, 200, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tr := newPeakTracker(10, false, 0)
+		for i, sc := range tt.scrapes {
+			if got := tr.observe(sc.target, sc.kind, "rps", sc.value, sc.ts, now); got != sc.want {
+				t.Errorf("%s, scrape %d: got %v, want %v", tt.name, i, got, sc.want)
+			}
+		}
+	}
+}
+
+func TestPeakTrackerHistory(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	tr := newPeakTracker(2, false, 0)
+	for ts := int64(100); ts <= 400; ts += 100 {
+		tr.observe("a", "request_rate", "rps", float64(ts), ts, now)
+	}
+
+	rec := httptest.NewRecorder()
+	tr.ServeHTTP(rec, httptest.NewRequest("GET", "/peaks", nil))
+	var body struct {
+		Events []peakEvent `json:"events"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Events) != 2 || body.Events[0].Value != 300 || body.Events[1].Value != 400 || body.Events[1].PreviousValue != 300 {
+		t.Errorf("events %+v, want the last two peaks 300 and 400", body.Events)
+	}
+
+	none := newPeakTracker(0, false, 0)
+	none.observe("a", "request_rate", "rps", 1, 100, now)
+	if !none.observe("a", "request_rate", "rps", 2, 200, now) || len(none.history) != 0 {
+		t.Errorf("limit 0: history %v", none.history)
+	}
+}
+
+func TestPeakTrackerRetention(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	tr := newPeakTracker(10, false, time.Hour)
+	tr.observe("gone", "request_rate", "rps", 10, 100, now)
+	tr.observe("kept", "request_rate", "rps", 10, 100, now.Add(90*time.Minute))
+
+	tr.observe("kept", "request_rate", "rps", 10, 100, now.Add(2*time.Hour))
+	if _, ok := tr.last["gone request_rate"]; ok {
+		t.Error("mark unseen for longer than the retention was kept")
+	}
+	if _, ok := tr.last["kept request_rate"]; !ok {
+		t.Error("recent mark was dropped")
+	}
+	// A pruned target comes back with a new baseline, not an event.
+	if tr.observe("gone", "request_rate", "rps", 20, 200, now.Add(2*time.Hour)) {
+		t.Error("pruned target reported a peak")
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// s3BlobStore is one S3-compatible bucket/prefix holding a GWC tile cache.
+type s3BlobStore struct {
+	name      string // blob store id from geowebcache.xml, or the bucket
+	bucket    string
+	prefix    string
+	endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://minio:9000
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+}
+
+// s3BlobStoresFromConfig returns the enabled S3 blob stores of geowebcache.xml.
+// Missing credentials and endpoint fall back to the exporter's settings.
+func s3BlobStoresFromConfig(cfg *gwcConfig, fallback s3BlobStore) []s3BlobStore {
+	if cfg == nil {
+		return nil
+	}
+	var out []s3BlobStore
+	for _, b := range cfg.BlobStores.Items {
+		if b.XMLName.Local != "S3BlobStore" || b.Bucket == "" || enabledString(b.Enabled) != "true" {
+			continue
+		}
+		s := fallback
+		s.name, s.bucket, s.prefix = b.ID, b.Bucket, b.Prefix
+		if b.Endpoint != "" {
+			s.endpoint = b.Endpoint
+		}
+		if b.AccessKey != "" {
+			s.accessKey, s.secretKey, s.token = b.AccessKey, b.SecretKey, ""
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// restBlobStores mirrors GWC's /rest/blobstores listing.
+type restBlobStores struct {
+	BlobStores []struct {
+		Name string `xml:"name"`
+	} `xml:"blobStore"`
+}
+
+// s3BlobStoresFromREST reads the blob stores of a running GWC through
+// /rest/blobstores and returns its enabled S3 blob stores, like
+// s3BlobStoresFromConfig does for geowebcache.xml.
+func s3BlobStoresFromREST(ctx context.Context, targetURL string, auth basicAuth, fallback s3BlobStore) ([]s3BlobStore, error) {
+	body, err := fetchURL(ctx, gwcServiceURL(targetURL, "/rest/blobstores"), auth)
+	if err != nil {
+		return nil, err
+	}
+	var list restBlobStores
+	if err := xml.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	cfg := &gwcConfig{}
+	for _, b := range list.BlobStores {
+		body, err := fetchURL(ctx, gwcServiceURL(targetURL, "/rest/blobstores/"+url.PathEscape(b.Name)+".xml"), auth)
+		if err != nil {
+			return nil, fmt.Errorf("blob store %q: %w", b.Name, err)
+		}
+		var store gwcConfigBlobStore
+		if err := xml.Unmarshal(body, &store); err != nil {
+			return nil, fmt.Errorf("blob store %q: %w", b.Name, err)
+		}
+		if store.ID == "" {
+			store.ID = b.Name
+		}
+		cfg.BlobStores.Items = append(cfg.BlobStores.Items, store)
+	}
+	return s3BlobStoresFromConfig(cfg, fallback), nil
+}
+
+// s3RESTStores returns a store list for the S3 collector that asks the REST
+// API on every cycle and keeps the last good answer when it fails.
+func s3RESTStores(targetURL string, auth basicAuth, fallback s3BlobStore, timeout time.Duration) func() []s3BlobStore {
+	var last []s3BlobStore
+	return func() []s3BlobStore {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		stores, err := s3BlobStoresFromREST(ctx, targetURL, auth, fallback)
+		if err != nil {
+			log.Printf("s3: cannot read blob stores from REST API url=%q err=%v", targetURL, err)
+			return last
+		}
+		last = stores
+		return stores
+	}
+}
+
+type s3TileKey struct {
+	layer, gridset, zoom string
+}
+
+type s3Totals struct {
+	objects float64
+	bytes   float64
+}
+
+// s3Scan is the state of one listing pass; it spans several cycles when the
+// request budget runs out before the bucket is fully listed.
+type s3Scan struct {
+	token    string
+	started  time.Time
+	requests int
+	tiles    map[s3TileKey]*s3Totals
+	other    s3Totals
+}
+
+type s3Result struct {
+	finished time.Time
+	duration time.Duration
+	requests int
+	tiles    map[s3TileKey]*s3Totals
+	other    s3Totals
+}
+
+// s3Collector lists S3 blob stores in the background and aggregates object
+// counts and bytes per layer, grid set and zoom following GWC's key layout
+// {prefix}/{layer}/{gridset}/{format}/{parameters}/{z}/{x}/{y}.{ext}.
+// Each cycle issues at most budget ListObjectsV2 requests, spaced by pace, and
+// resumes from the continuation token in the next cycle.
+type s3Collector struct {
+	stores   func() []s3BlobStore
+	interval time.Duration
+	budget   int
+	pace     time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	scans   map[string]*s3Scan
+	results map[string]*s3Result
+
+	requests_total *prometheus.CounterVec // labels: blob_store, result
+
+	objects          *prometheus.Desc // labels: blob_store, layer, gridset, zoom
+	bytes            *prometheus.Desc // labels: blob_store, layer, gridset, zoom
+	other_objects    *prometheus.Desc // label: blob_store
+	scan_in_progress *prometheus.Desc // label: blob_store
+	scan_duration    *prometheus.Desc // label: blob_store
+	scan_requests    *prometheus.Desc // label: blob_store
+	scan_timestamp   *prometheus.Desc // label: blob_store
+}
+
+func newS3Collector(stores func() []s3BlobStore, interval time.Duration, budget int, pace time.Duration, timeout time.Duration) *s3Collector {
+	const ns = "gwc_s3"
+	return &s3Collector{
+		stores:   stores,
+		interval: interval,
+		budget:   budget,
+		pace:     pace,
+		client:   &http.Client{Timeout: timeout},
+		scans:    map[string]*s3Scan{},
+		results:  map[string]*s3Result{},
+
+		requests_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_list_requests_total",
+			Help: "ListObjectsV2 requests sent, by result.",
+		}, []string{"blob_store", "result"}),
+
+		objects:          prometheus.NewDesc(ns+"_objects", "Tile objects per layer, grid set and zoom at the last complete listing.", []string{"blob_store", "layer", "gridset", "zoom"}, nil),
+		bytes:            prometheus.NewDesc(ns+"_bytes", "Tile object bytes per layer, grid set and zoom at the last complete listing.", []string{"blob_store", "layer", "gridset", "zoom"}, nil),
+		other_objects:    prometheus.NewDesc(ns+"_other_objects", "Objects under the prefix that are not tiles (metadata, ...).", []string{"blob_store"}, nil),
+		scan_in_progress: prometheus.NewDesc(ns+"_scan_in_progress", "1 while a listing pass is spread over several cycles, else 0.", []string{"blob_store"}, nil),
+		scan_duration:    prometheus.NewDesc(ns+"_scan_duration_seconds", "Wall time of the last complete listing pass.", []string{"blob_store"}, nil),
+		scan_requests:    prometheus.NewDesc(ns+"_scan_requests", "ListObjectsV2 requests of the last complete listing pass.", []string{"blob_store"}, nil),
+		scan_timestamp:   prometheus.NewDesc(ns+"_last_scan_timestamp_seconds", "Unix time the last complete listing pass finished.", []string{"blob_store"}, nil),
+	}
+}
+
+func (c *s3Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests_total.Describe(ch)
+	ch <- c.objects
+	ch <- c.bytes
+	ch <- c.other_objects
+	ch <- c.scan_in_progress
+	ch <- c.scan_duration
+	ch <- c.scan_requests
+	ch <- c.scan_timestamp
+}
+
+func (c *s3Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests_total.Collect(ch)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, r := range c.results {
+		inProgress := 0.0
+		if _, ok := c.scans[name]; ok {
+			inProgress = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.scan_in_progress, prometheus.GaugeValue, inProgress, name)
+		ch <- prometheus.MustNewConstMetric(c.scan_duration, prometheus.GaugeValue, r.duration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.scan_requests, prometheus.GaugeValue, float64(r.requests), name)
+		ch <- prometheus.MustNewConstMetric(c.scan_timestamp, prometheus.GaugeValue, float64(r.finished.Unix()), name)
+		ch <- prometheus.MustNewConstMetric(c.other_objects, prometheus.GaugeValue, r.other.objects, name)
+		for k, t := range r.tiles {
+			ch <- prometheus.MustNewConstMetric(c.objects, prometheus.GaugeValue, t.objects, name, k.layer, k.gridset, k.zoom)
+			ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, t.bytes, name, k.layer, k.gridset, k.zoom)
+		}
+	}
+}
+
+func (c *s3Collector) run(ctx context.Context) {
+	for {
+		c.cycle(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// cycle continues (or starts) one listing pass per blob store within the budget.
+func (c *s3Collector) cycle(ctx context.Context) {
+	remaining := c.budget
+	for _, store := range c.stores() {
+		c.mu.Lock()
+		scan := c.scans[store.name]
+		if scan == nil {
+			scan = &s3Scan{started: time.Now(), tiles: map[s3TileKey]*s3Totals{}}
+			c.scans[store.name] = scan
+		}
+		c.mu.Unlock()
+
+		for c.budget <= 0 || remaining > 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			page, err := c.listPage(ctx, store, scan.token)
+			remaining--
+			scan.requests++
+			if err != nil {
+				c.requests_total.WithLabelValues(store.name, "error").Inc()
+				log.Printf("s3: list failed blob_store=%q bucket=%q err=%v", store.name, store.bucket, err)
+				break
+			}
+			c.requests_total.WithLabelValues(store.name, "ok").Inc()
+			for _, obj := range page.Contents {
+				scan.add(store.prefix, obj.Key, float64(obj.Size))
+			}
+			if !page.IsTruncated || page.NextContinuationToken == "" {
+				c.finish(store.name, scan)
+				break
+			}
+			scan.token = page.NextContinuationToken
+			if c.pace > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(c.pace):
+				}
+			}
+		}
+	}
+}
+
+func (c *s3Collector) finish(name string, scan *s3Scan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[name] = &s3Result{
+		finished: time.Now(),
+		duration: time.Since(scan.started),
+		requests: scan.requests,
+		tiles:    scan.tiles,
+		other:    scan.other,
+	}
+	delete(c.scans, name)
+}
+
+func (s *s3Scan) add(prefix, key string, size float64) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(key, strings.Trim(prefix, "/")), "/")
+	parts := strings.Split(rel, "/")
+	// layer/gridset/format/parameters/z/x/y.ext
+	if len(parts) != 7 {
+		s.other.objects++
+		s.other.bytes += size
+		return
+	}
+	k := s3TileKey{layer: parts[0], gridset: parts[1], zoom: parts[4]}
+	t := s.tiles[k]
+	if t == nil {
+		t = &s3Totals{}
+		s.tiles[k] = t
+	}
+	t.objects++
+	t.bytes += size
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// listPage sends one path-style ListObjectsV2 request.
+func (c *s3Collector) listPage(ctx context.Context, store s3BlobStore, token string) (*s3ListResult, error) {
+	q := url.Values{}
+	q.Set("list-type", "2")
+	q.Set("max-keys", "1000")
+	if p := strings.Trim(store.prefix, "/"); p != "" {
+		q.Set("prefix", p+"/")
+	}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+	u, err := url.Parse(strings.TrimRight(store.endpoint, "/") + "/" + store.bucket)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = s3CanonicalQuery(q)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, store, time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status=%d body=%.200s", resp.StatusCode, body)
+	}
+	var out s3ListResult
+	if err := xml.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 for a body-less request.
+// Without credentials the request stays anonymous (public buckets).
+func signS3Request(req *http.Request, store s3BlobStore, now time.Time) {
+	const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if store.accessKey == "" {
+		return
+	}
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayload)
+	if store.token != "" {
+		req.Header.Set("x-amz-security-token", store.token)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": emptyPayload,
+		"x-amz-date":           amzDate,
+	}
+	if store.token != "" {
+		headers["x-amz-security-token"] = store.token
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonURI := req.URL.EscapedPath()
+	if canonURI == "" {
+		canonURI = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method, canonURI, req.URL.RawQuery, canonHeaders.String(), signedHeaders, emptyPayload,
+	}, "\n")
+
+	scope := day + "/" + store.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+store.secretKey), day)
+	key = hmacSHA256(key, store.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+store.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3CanonicalQuery encodes q sorted and with RFC 3986 escaping, as SigV4 requires.
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// s3DefaultStore builds the explicitly configured blob store; credentials
+// come from the usual AWS environment variables.
+func s3DefaultStore(bucket, prefix, endpoint, region string) s3BlobStore {
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return s3BlobStore{
+		name:      bucket,
+		bucket:    bucket,
+		prefix:    prefix,
+		endpoint:  endpoint,
+		region:    region,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
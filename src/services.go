@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tmsTileMapService mirrors the TMS 1.0.0 root resource.
+type tmsTileMapService struct {
+	XMLName  xml.Name
+	TileMaps []struct {
+		Title string `xml:"title,attr"`
+		Href  string `xml:"href,attr"`
+	} `xml:"TileMaps>TileMap"`
+}
+
+// tmsHrefLayer returns the layer of a TileMap href such as
+// .../service/tms/1.0.0/topp%3Astates@EPSG%3A4326@png.
+func tmsHrefLayer(href string) string {
+	seg := href[strings.LastIndexByte(strings.TrimRight(href, "/"), '/')+1:]
+	seg = strings.TrimRight(seg, "/")
+	layer, _, _ := strings.Cut(seg, "@")
+	if l, err := url.PathUnescape(layer); err == nil {
+		return l
+	}
+	return layer
+}
+
+// wmscCapabilities mirrors a WMS 1.1.1 capabilities document with the WMS-C
+// TileSet vendor extension GWC adds for tiled=true.
+type wmscCapabilities struct {
+	XMLName    xml.Name
+	Capability struct {
+		TileSets []struct{} `xml:"VendorSpecificCapabilities>TileSet"`
+		Layer    wmsLayer   `xml:"Layer"`
+	} `xml:"Capability"`
+}
+
+type wmsLayer struct {
+	Name   string     `xml:"Name"`
+	Layers []wmsLayer `xml:"Layer"`
+}
+
+func (l wmsLayer) names(out map[string]bool) {
+	if l.Name != "" {
+		out[l.Name] = true
+	}
+	for _, sub := range l.Layers {
+		sub.names(out)
+	}
+}
+
+type serviceProbe struct {
+	service string
+	path    string
+	// parse returns the layers and tile maps (TMS TileMaps, WMS-C TileSets)
+	// advertised by the document.
+	parse func(body []byte) (layers, tileMaps int, err error)
+}
+
+var serviceProbes = map[string]serviceProbe{
+	"tms": {
+		service: "tms",
+		path:    "/service/tms/1.0.0",
+		parse: func(body []byte) (int, int, error) {
+			var doc tmsTileMapService
+			if err := xml.Unmarshal(body, &doc); err != nil {
+				return 0, 0, err
+			}
+			if doc.XMLName.Local != "TileMapService" {
+				return 0, 0, fmt.Errorf("root element is %s", doc.XMLName.Local)
+			}
+			// One TileMap per layer, grid set and format. Titles need not be
+			// unique, so layers are told apart by the href.
+			layers := map[string]bool{}
+			for _, tm := range doc.TileMaps {
+				if l := tmsHrefLayer(tm.Href); l != "" {
+					layers[l] = true
+				} else {
+					layers["title:"+tm.Title] = true
+				}
+			}
+			return len(layers), len(doc.TileMaps), nil
+		},
+	},
+	"wmsc": {
+		service: "wmsc",
+		path:    "/service/wms?SERVICE=WMS&VERSION=1.1.1&REQUEST=GetCapabilities&TILED=true",
+		parse: func(body []byte) (int, int, error) {
+			var doc wmscCapabilities
+			if err := xml.Unmarshal(body, &doc); err != nil {
+				return 0, 0, err
+			}
+			if doc.XMLName.Local != "WMT_MS_Capabilities" {
+				return 0, 0, fmt.Errorf("root element is %s", doc.XMLName.Local)
+			}
+			names := map[string]bool{}
+			doc.Capability.Layer.names(names)
+			return len(names), len(doc.Capability.TileSets), nil
+		},
+	},
+}
+
+// serviceCollector probes GWC's TMS and WMS-C endpoints on every scrape so
+// each service protocol has its own health signal next to gwc_up, which only
+// covers the home page.
+type serviceCollector struct {
+	targetURL string
+	probes    []serviceProbe
+	timeout   time.Duration
+
+	up        *prometheus.Desc // label: service
+	duration  *prometheus.Desc // label: service
+	layers    *prometheus.Desc // label: service
+	tile_maps *prometheus.Desc // label: service
+}
+
+func newServiceCollector(targetURL string, services []string, timeout time.Duration) (*serviceCollector, error) {
+	const ns = "gwc_service"
+	c := &serviceCollector{
+		targetURL: targetURL,
+		timeout:   timeout,
+
+		up:        prometheus.NewDesc(ns+"_up", "Was the last probe of the service endpoint successful (HTTP 200 and a parseable document).", []string{"service"}, nil),
+		duration:  prometheus.NewDesc(ns+"_probe_duration_seconds", "Response time of the last probe of the service endpoint.", []string{"service"}, nil),
+		layers:    prometheus.NewDesc(ns+"_layers", "Layers advertised by the service endpoint.", []string{"service"}, nil),
+		tile_maps: prometheus.NewDesc(ns+"_tile_maps", "TMS TileMaps or WMS-C TileSets advertised by the service endpoint.", []string{"service"}, nil),
+	}
+	seen := map[string]bool{}
+	for _, s := range services {
+		p, ok := serviceProbes[s]
+		if !ok {
+			return nil, fmt.Errorf("unknown service %q (want tms or wmsc)", s)
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		c.probes = append(c.probes, p)
+	}
+	return c, nil
+}
+
+func (c *serviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.duration
+	ch <- c.layers
+	ch <- c.tile_maps
+}
+
+func (c *serviceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.probes {
+		c.probe(ch, p)
+	}
+}
+
+func (c *serviceCollector) probe(ch chan<- prometheus.Metric, p serviceProbe) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	url := gwcServiceURL(c.targetURL, p.path)
+	start := time.Now()
+	body, err := fetchURL(ctx, url, basicAuth{})
+	ch <- prometheus.MustNewConstMetric(c.duration, prometheus.GaugeValue, time.Since(start).Seconds(), p.service)
+	if err != nil {
+		log.Printf("service probe: request failed service=%s target=%q err=%v", p.service, url, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0, p.service)
+		return
+	}
+	layers, tileMaps, err := p.parse(body)
+	if err != nil {
+		log.Printf("service probe: cannot parse response service=%s target=%q err=%v", p.service, url, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0, p.service)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1, p.service)
+	ch <- prometheus.MustNewConstMetric(c.layers, prometheus.GaugeValue, float64(layers), p.service)
+	ch <- prometheus.MustNewConstMetric(c.tile_maps, prometheus.GaugeValue, float64(tileMaps), p.service)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// GWC replaces the statistics table with a short note when runtime stats
+// are switched off; the wording differs between versions.
+var statsDisabledRe = regexp.MustCompile(`(?i)runtime stat(?:istic)?s\s*(?:are|is)?\s*(?:disabled|not enabled|not available|unavailable|turned off)`)
+
+// statsFreshness detects GWC's runtime statistics thread having stopped: the
+// page still renders and uptime grows, but totals and interval rows no longer
+// move. An idle cache looks the same except that its interval rows drop to
+// zero, so a target only counts as stale while the frozen rows still claim
+// traffic.
+type statsFreshness struct {
+	limit int // unchanged scrapes before stale; 0 disables
+
+	mu        sync.Mutex
+	last      string
+	unchanged int
+	changed   time.Time // exporter clock at the last change
+	scraped   time.Time // exporter clock at the last observe
+	spacing   time.Duration
+}
+
+func (f *statsFreshness) observe(st homeStats, now time.Time) (unchanged int, stale bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fp := fmt.Sprint(st.requests, st.untiledRequests, st.bytes, st.intervals)
+	if fp == f.last {
+		f.unchanged++
+	} else {
+		f.last = fp
+		f.unchanged = 0
+		f.changed = now
+	}
+	if !f.scraped.IsZero() {
+		f.spacing = now.Sub(f.scraped)
+	}
+	f.scraped = now
+	return f.unchanged, f.limit > 0 && f.unchanged >= f.limit && intervalsClaimTraffic(st)
+}
+
+// age returns how long the statistics have not changed as of the last
+// observe, and the time between the last two observes (0 after the first).
+func (f *statsFreshness) age() (age, spacing time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scraped.Sub(f.changed), f.spacing
+}
+
+func intervalsClaimTraffic(st homeStats) bool {
+	for _, iv := range st.intervals {
+		if iv.requests > 0 {
+			return true
+		}
+	}
+	return false
+}
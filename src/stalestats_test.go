@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsFreshnessObserve(t *testing.T) {
+	busy := []homeInterval{{window: "3 seconds", seconds: 3, requests: 12}}
+	idle := []homeInterval{{window: "3 seconds", seconds: 3}}
+	type scrape struct {
+		st            homeStats
+		wantUnchanged int
+		wantStale     bool
+	}
+	tests := []struct {
+		name    string
+		limit   int
+		scrapes []scrape
+	}{
+		{
+			name:  "moving",
+			limit: 2,
+			scrapes: []scrape{
+				{homeStats{requests: 10, intervals: busy}, 0, false},
+				{homeStats{requests: 20, intervals: busy}, 0, false},
+				{homeStats{requests: 30, intervals: busy}, 0, false},
+			},
+		},
+		{
+			name:  "frozen with traffic",
+			limit: 2,
+			scrapes: []scrape{
+				{homeStats{requests: 10, intervals: busy}, 0, false},
+				{homeStats{requests: 10, intervals: busy}, 1, false},
+				{homeStats{requests: 10, intervals: busy}, 2, true},
+				{homeStats{requests: 10, intervals: busy}, 3, true},
+				{homeStats{requests: 11, intervals: busy}, 0, false},
+			},
+		},
+		{
+			name:  "idle",
+			limit: 2,
+			scrapes: []scrape{
+				{homeStats{requests: 10, intervals: idle}, 0, false},
+				{homeStats{requests: 10, intervals: idle}, 1, false},
+				{homeStats{requests: 10, intervals: idle}, 2, false},
+			},
+		},
+		{
+			name:  "only bytes move",
+			limit: 1,
+			scrapes: []scrape{
+				{homeStats{requests: 10, bytes: 100, intervals: busy}, 0, false},
+				{homeStats{requests: 10, bytes: 200, intervals: busy}, 0, false},
+			},
+		},
+		{
+			name:  "interval rows move",
+			limit: 1,
+			scrapes: []scrape{
+				{homeStats{requests: 10, intervals: busy}, 0, false},
+				{homeStats{requests: 10, intervals: []homeInterval{{window: "3 seconds", seconds: 3, requests: 13}}}, 0, false},
+			},
+		},
+		{
+			name:  "disabled",
+			limit: 0,
+			scrapes: []scrape{
+				{homeStats{requests: 10, intervals: busy}, 0, false},
+				{homeStats{requests: 10, intervals: busy}, 1, false},
+				{homeStats{requests: 10, intervals: busy}, 2, false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		f := statsFreshness{limit: tt.limit}
+		for i, sc := range tt.scrapes {
+			unchanged, stale := f.observe(sc.st, time.Unix(int64(1_800_000_000+15*i), 0))
+			if unchanged != sc.wantUnchanged || stale != sc.wantStale {
+				t.Errorf("%s, scrape %d: got %d unchanged, stale %v; want %d, %v", tt.name, i, unchanged, stale, sc.wantUnchanged, sc.wantStale)
+			}
+		}
+	}
+}
+
+func TestStatsFreshnessAge(t *testing.T) {
+	start := time.Unix(1_800_000_000, 0)
+	tests := []struct {
+		at                   time.Duration
+		requests             float64
+		wantAge, wantSpacing time.Duration
+	}{
+		{0, 10, 0, 0},
+		{15 * time.Second, 10, 15 * time.Second, 15 * time.Second},
+		{45 * time.Second, 10, 45 * time.Second, 30 * time.Second},
+		{60 * time.Second, 11, 0, 15 * time.Second},
+		{75 * time.Second, 11, 15 * time.Second, 15 * time.Second},
+	}
+	var f statsFreshness
+	for i, tt := range tests {
+		f.observe(homeStats{requests: tt.requests}, start.Add(tt.at))
+		if age, spacing := f.age(); age != tt.wantAge || spacing != tt.wantSpacing {
+			t.Errorf("scrape %d: age %v, spacing %v; want %v, %v", i, age, spacing, tt.wantAge, tt.wantSpacing)
+		}
+	}
+}
+
+func TestStatsDisabledRe(t *testing.T) {
+	tests := []struct {
+		html string
+		want bool
+	}{
+		{"<p>Runtime statistics are disabled.</p>", true},
+		{"Runtime stats not enabled", true},
+		{"runtime statistics is turned off", true},
+		{"Runtime Statistics unavailable", true},
+		{"<th>Runtime Statistics</th><td>Started:</td>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := statsDisabledRe.MatchString(tt.html); got != tt.want {
+			t.Errorf("statsDisabledRe.MatchString(%q) = %v, want %v", tt.html, got, tt.want)
+		}
+	}
+}
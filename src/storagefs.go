@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fsStats struct {
+	mountPoint string
+	fsType     string
+	size       float64
+	free       float64
+	avail      float64
+	files      float64
+	filesFree  float64
+}
+
+// storageFSCollector reports capacity of the filesystem holding the tile
+// cache. statfs is cheap, so it runs on every scrape; paths that are not
+// mounted into the exporter are skipped.
+type storageFSCollector struct {
+	path      string // directory, or "auto" for the Local Storage directory on the home page
+	homePaths func() (configFile, localStorage string)
+
+	size_bytes  *prometheus.Desc // labels: path, mountpoint, fstype
+	free_bytes  *prometheus.Desc
+	avail_bytes *prometheus.Desc
+	files       *prometheus.Desc
+	files_free  *prometheus.Desc
+}
+
+func newStorageFSCollector(path string, homePaths func() (string, string)) *storageFSCollector {
+	const ns = "gwc_storage_fs"
+	labels := []string{"path", "mountpoint", "fstype"}
+	return &storageFSCollector{
+		path:      path,
+		homePaths: homePaths,
+
+		size_bytes:  prometheus.NewDesc(ns+"_size_bytes", "Size of the filesystem holding the tile cache.", labels, nil),
+		free_bytes:  prometheus.NewDesc(ns+"_free_bytes", "Free bytes on the filesystem holding the tile cache, including root-reserved blocks.", labels, nil),
+		avail_bytes: prometheus.NewDesc(ns+"_avail_bytes", "Bytes available to unprivileged users on the filesystem holding the tile cache.", labels, nil),
+		files:       prometheus.NewDesc(ns+"_files", "Inodes on the filesystem holding the tile cache.", labels, nil),
+		files_free:  prometheus.NewDesc(ns+"_files_free", "Free inodes on the filesystem holding the tile cache.", labels, nil),
+	}
+}
+
+func (c *storageFSCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size_bytes
+	ch <- c.free_bytes
+	ch <- c.avail_bytes
+	ch <- c.files
+	ch <- c.files_free
+}
+
+// errStatFSUnsupported is returned by statFS on platforms without it.
+var errStatFSUnsupported = errors.New("filesystem statistics are only supported on linux")
+
+func (c *storageFSCollector) Collect(ch chan<- prometheus.Metric) {
+	path := c.path
+	if path == "auto" {
+		_, path = c.homePaths()
+	}
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	st, err := statFS(path)
+	if errors.Is(err, errStatFSUnsupported) {
+		return
+	}
+	if err != nil {
+		log.Printf("storage fs: statfs failed path=%q err=%v", path, err)
+		return
+	}
+
+	lv := []string{path, st.mountPoint, st.fsType}
+	ch <- prometheus.MustNewConstMetric(c.size_bytes, prometheus.GaugeValue, st.size, lv...)
+	ch <- prometheus.MustNewConstMetric(c.free_bytes, prometheus.GaugeValue, st.free, lv...)
+	ch <- prometheus.MustNewConstMetric(c.avail_bytes, prometheus.GaugeValue, st.avail, lv...)
+	ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, st.files, lv...)
+	ch <- prometheus.MustNewConstMetric(c.files_free, prometheus.GaugeValue, st.filesFree, lv...)
+}
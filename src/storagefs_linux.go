@@ -0,0 +1,102 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func statFS(path string) (fsStats, error) {
+	var s syscall.Statfs_t
+	if err := syscall.Statfs(path, &s); err != nil {
+		return fsStats{}, err
+	}
+	// df uses the fragment size for block counts when the kernel reports one.
+	bsize := float64(s.Frsize)
+	if bsize == 0 {
+		bsize = float64(s.Bsize)
+	}
+	st := fsStats{
+		size:      float64(s.Blocks) * bsize,
+		free:      float64(s.Bfree) * bsize,
+		avail:     float64(s.Bavail) * bsize,
+		files:     float64(s.Files),
+		filesFree: float64(s.Ffree),
+	}
+	st.mountPoint, st.fsType = findMount(path)
+	return st, nil
+}
+
+// findMount returns the mount point and filesystem type of the longest
+// /proc/self/mountinfo entry containing path.
+func findMount(path string) (string, string) {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	if p, err := filepath.Abs(path); err == nil {
+		path = p
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	var mountPoint, fsType string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+1 >= len(fields) {
+			continue
+		}
+		mp := unescapeMountPath(fields[4])
+		if !pathWithin(path, mp) || len(mp) < len(mountPoint) {
+			continue
+		}
+		// Later entries with the same mount point are stacked on top.
+		mountPoint, fsType = mp, fields[sep+1]
+	}
+	return mountPoint, fsType
+}
+
+func pathWithin(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space etc.) the
+// kernel uses in mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
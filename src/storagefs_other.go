@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func statFS(path string) (fsStats, error) {
+	return fsStats{}, errStatFSUnsupported
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileFollower behaves like `tail -F`: it keeps reading lines from a file and
+// survives rotation. The path may be a glob (e.g. Tomcat's date-stamped
+// localhost_access_log.*.txt), in which case the most recently modified match
+// is followed. A rename/recreate (inode change) or truncation reopens the file
+// from the start; the very first file is read from its end so that history
+// already on disk is not replayed on exporter start.
+type fileFollower struct {
+	pattern string
+	poll    time.Duration
+	onLine  func(line string)
+
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+	started bool
+}
+
+func newFileFollower(pattern string, poll time.Duration, onLine func(string)) *fileFollower {
+	return &fileFollower{pattern: pattern, poll: poll, onLine: onLine}
+}
+
+func (f *fileFollower) run(ctx context.Context) {
+	ticker := time.NewTicker(f.poll)
+	defer ticker.Stop()
+	defer f.close()
+
+	for {
+		f.step()
+		// Only a file that already existed on the first step is skipped; one
+		// created later is read from its start.
+		f.started = true
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *fileFollower) step() {
+	if f.file != nil {
+		f.drain()
+	}
+
+	path, err := f.currentPath()
+	if err != nil {
+		return
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case f.file == nil || !os.SameFile(f.info, st):
+		// Rotated (or first open): finish the old file, then switch.
+		if f.file != nil {
+			f.drain()
+			f.close()
+		}
+		f.open(path, st)
+		f.drain()
+	case st.Size() < f.offset:
+		// Truncated in place (copytruncate).
+		log.Printf("tail: file truncated path=%q", path)
+		if _, err := f.file.Seek(0, io.SeekStart); err == nil {
+			f.offset = 0
+			f.partial = ""
+			f.reader.Reset(f.file)
+			f.drain()
+		}
+	}
+}
+
+func (f *fileFollower) currentPath() (string, error) {
+	if !strings.ContainsAny(f.pattern, "*?[") {
+		return f.pattern, nil
+	}
+	matches, err := filepath.Glob(f.pattern)
+	if err != nil {
+		return "", err
+	}
+	var (
+		newest  string
+		newestT time.Time
+	)
+	for _, m := range matches {
+		st, err := os.Stat(m)
+		if err != nil || st.IsDir() {
+			continue
+		}
+		if newest == "" || st.ModTime().After(newestT) {
+			newest, newestT = m, st.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", os.ErrNotExist
+	}
+	return newest, nil
+}
+
+func (f *fileFollower) open(path string, st os.FileInfo) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("tail: cannot open path=%q err=%v", path, err)
+		return
+	}
+	var offset int64
+	if !f.started {
+		// Skip what is already on disk when the exporter starts.
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			offset = 0
+		}
+	}
+	f.file = file
+	f.info = st
+	f.offset = offset
+	f.partial = ""
+	if f.reader == nil {
+		f.reader = bufio.NewReaderSize(file, 64*1024)
+	} else {
+		f.reader.Reset(file)
+	}
+	log.Printf("tail: following path=%q offset=%d", path, offset)
+}
+
+func (f *fileFollower) drain() {
+	if f.file == nil {
+		return
+	}
+	for {
+		chunk, err := f.reader.ReadString('\n')
+		f.offset += int64(len(chunk))
+		if err != nil {
+			// Keep an unterminated last line until the writer finishes it.
+			f.partial += chunk
+			if !errors.Is(err, io.EOF) {
+				log.Printf("tail: read failed path=%q err=%v", f.file.Name(), err)
+			}
+			return
+		}
+		line := strings.TrimRight(f.partial+chunk, "\r\n")
+		f.partial = ""
+		if line != "" {
+			f.onLine(line)
+		}
+	}
+}
+
+func (f *fileFollower) close() {
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+}
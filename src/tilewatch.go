@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tileWatchCollector counts tile writes and deletes in file blob stores as
+// they happen, using inotify on Linux. Watches are placed on the directory
+// levels that hold tiles only, up to a configurable limit.
+type tileWatchCollector struct {
+	roots func() []string
+	limit int
+
+	mu           sync.Mutex
+	watchCount   int
+	limitReached bool
+
+	writes_total    *prometheus.CounterVec // label: layer
+	deletes_total   *prometheus.CounterVec // label: layer
+	overflows_total prometheus.Counter
+	watches         *prometheus.Desc
+	limit_reached   *prometheus.Desc
+}
+
+func newTileWatchCollector(roots func() []string, limit int) *tileWatchCollector {
+	const ns = "gwc_disk"
+	return &tileWatchCollector{
+		roots: roots,
+		limit: limit,
+
+		writes_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_tile_writes_total",
+			Help: "Tiles written to the file blob store (closed after writing or renamed into place).",
+		}, []string{"layer"}),
+		deletes_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ns + "_tile_deletes_total",
+			Help: "Tiles deleted from the file blob store.",
+		}, []string{"layer"}),
+		overflows_total: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: ns + "_watch_overflows_total",
+			Help: "inotify queue overflows; events were lost and the counters undercount.",
+		}),
+		watches:       prometheus.NewDesc(ns+"_watches", "Directories watched for tile writes.", nil, nil),
+		limit_reached: prometheus.NewDesc(ns+"_watch_limit_reached", "1 if directories were left unwatched because of the watch limit, else 0.", nil, nil),
+	}
+}
+
+func (c *tileWatchCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.writes_total.Describe(ch)
+	c.deletes_total.Describe(ch)
+	c.overflows_total.Describe(ch)
+	ch <- c.watches
+	ch <- c.limit_reached
+}
+
+func (c *tileWatchCollector) Collect(ch chan<- prometheus.Metric) {
+	c.writes_total.Collect(ch)
+	c.deletes_total.Collect(ch)
+	c.overflows_total.Collect(ch)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reached := 0.0
+	if c.limitReached {
+		reached = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.watches, prometheus.GaugeValue, float64(c.watchCount))
+	ch <- prometheus.MustNewConstMetric(c.limit_reached, prometheus.GaugeValue, reached)
+}
@@ -0,0 +1,258 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	tileWatchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO |
+		syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_ONLYDIR
+
+	// Tiles live three directory levels below the root; deeper directories
+	// are not watched.
+	tileWatchDepth = 3
+
+	tileWatchRescan = time.Minute
+)
+
+type watchedDir struct {
+	root string
+	rel  string // relative to root, "." for the root itself
+}
+
+type inotifyWatcher struct {
+	c     *tileWatchCollector
+	fd    int
+	dirs  map[int32]watchedDir
+	roots map[string]bool
+
+	// fullAt is the watch count when a directory was last left unwatched
+	// (configured limit or fs.inotify.max_user_watches), 0 if none was.
+	fullAt int
+}
+
+func (c *tileWatchCollector) run(ctx context.Context) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		log.Printf("tile watch: inotify init failed err=%v", err)
+		return
+	}
+	// A non-blocking fd goes through the runtime poller, so Close unblocks Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	w := &inotifyWatcher{c: c, fd: fd, dirs: map[int32]watchedDir{}, roots: map[string]bool{}}
+
+	events := make(chan []byte)
+	go func() {
+		defer close(events)
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("tile watch: read failed err=%v", err)
+				}
+				return
+			}
+			events <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	defer f.Close()
+
+	// Roots can appear late ("auto" needs a home page scrape), so look again
+	// periodically. All watch bookkeeping stays on this goroutine.
+	w.addRoots()
+	ticker := time.NewTicker(tileWatchRescan)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.addRoots()
+			w.retryUnwatched()
+		case b, ok := <-events:
+			if !ok {
+				return
+			}
+			w.handle(b)
+		}
+	}
+}
+
+func (w *inotifyWatcher) addRoots() {
+	for _, root := range w.c.roots() {
+		if w.roots[root] {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		w.roots[root] = true
+		w.addTree(root, ".", false)
+		log.Printf("tile watch: watching root=%q watches=%d", root, len(w.dirs))
+	}
+}
+
+// addTree watches dir and its subdirectories down to the tile level. For a
+// directory that appeared at runtime countFiles counts the tiles already in
+// it: they can be written before its watch is in place. A tile written right
+// after the watch was added may then be counted twice.
+func (w *inotifyWatcher) addTree(root, rel string, countFiles bool) {
+	start := filepath.Join(root, rel)
+	_ = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		r, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if layer, _, _, ok := parseDiskTilePath(r); ok && countFiles {
+				w.c.writes_total.WithLabelValues(layer).Inc()
+			}
+			return nil
+		}
+		if dirDepth(r) > tileWatchDepth {
+			return filepath.SkipDir
+		}
+		if !w.add(root, r) {
+			return filepath.SkipAll
+		}
+		if dirDepth(r) == tileWatchDepth && !countFiles {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// add places a single watch; false means the limit was hit. Adding a watch
+// for a directory that is already watched returns its descriptor again, so
+// the path is updated.
+func (w *inotifyWatcher) add(root, rel string) bool {
+	if len(w.dirs) >= w.c.limit {
+		w.setFull()
+		return false
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, filepath.Join(root, rel), tileWatchMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			// fs.inotify.max_user_watches is lower than the configured limit.
+			w.setFull()
+			return false
+		}
+		return true
+	}
+	w.dirs[int32(wd)] = watchedDir{root: root, rel: rel}
+	w.setCount()
+	return true
+}
+
+// remove drops the watches of a directory and everything below it, e.g.
+// after it was moved away.
+func (w *inotifyWatcher) remove(root, rel string) {
+	for wd, d := range w.dirs {
+		if d.root == root && (d.rel == rel || strings.HasPrefix(d.rel, rel+string(filepath.Separator))) {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+	w.setCount()
+}
+
+// retryUnwatched walks the roots again once watches were freed after the
+// limit was hit.
+func (w *inotifyWatcher) retryUnwatched() {
+	if w.fullAt == 0 || len(w.dirs) >= w.fullAt {
+		return
+	}
+	w.fullAt = 0
+	w.setCount()
+	for root := range w.roots {
+		w.addTree(root, ".", false)
+	}
+}
+
+// setCount publishes the live watch count; the limit counts as reached while
+// a directory is left unwatched.
+func (w *inotifyWatcher) setCount() {
+	w.c.mu.Lock()
+	w.c.watchCount = len(w.dirs)
+	w.c.limitReached = w.fullAt > 0
+	w.c.mu.Unlock()
+}
+
+func (w *inotifyWatcher) setFull() {
+	if w.fullAt == 0 {
+		log.Printf("tile watch: watch limit reached watches=%d, some directories are not watched", len(w.dirs))
+	}
+	w.fullAt = len(w.dirs)
+	w.setCount()
+}
+
+func (w *inotifyWatcher) handle(b []byte) {
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(b); {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&b[off]))
+		nameBytes := b[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+		off += syscall.SizeofInotifyEvent + int(ev.Len)
+		name := string(bytes.TrimRight(nameBytes, "\x00"))
+
+		if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			w.c.overflows_total.Inc()
+			continue
+		}
+		if ev.Mask&syscall.IN_IGNORED != 0 {
+			delete(w.dirs, ev.Wd)
+			w.setCount()
+			continue
+		}
+		dir, ok := w.dirs[ev.Wd]
+		if !ok || name == "" {
+			continue
+		}
+		rel := filepath.Join(dir.rel, name)
+		if ev.Mask&syscall.IN_ISDIR != 0 {
+			switch {
+			case ev.Mask&syscall.IN_MOVED_FROM != 0:
+				// The watches below keep working but would report the old
+				// path; a matching IN_MOVED_TO adds them again.
+				w.remove(dir.root, rel)
+			case ev.Mask&syscall.IN_CREATE != 0 && dirDepth(dir.rel) < tileWatchDepth:
+				w.addTree(dir.root, rel, true)
+			case ev.Mask&syscall.IN_MOVED_TO != 0 && dirDepth(dir.rel) < tileWatchDepth:
+				// Moved tiles are not new writes.
+				w.addTree(dir.root, rel, false)
+			}
+			continue
+		}
+		layer, _, _, ok := parseDiskTilePath(rel)
+		if !ok {
+			continue
+		}
+		switch {
+		case ev.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+			w.c.writes_total.WithLabelValues(layer).Inc()
+		case ev.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			w.c.deletes_total.WithLabelValues(layer).Inc()
+		}
+	}
+}
+
+func dirDepth(rel string) int {
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
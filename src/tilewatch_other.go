@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"log"
+)
+
+func (c *tileWatchCollector) run(ctx context.Context) {
+	log.Printf("tile watch: inotify is only supported on linux, watcher disabled")
+}
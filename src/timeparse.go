@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// GWC prints page timestamps with Java's default formatting, which depends on
+// the build, the JVM locale and the JVM time zone. parsePageTime normalizes
+// localized month names, drops weekdays and turns zone names into numeric
+// offsets before trying the layouts seen in the wild.
+
+var pageTimeLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700", // RFC1123 without the weekday
+	"2 Jan 2006 15:04:05",
+	"Jan 2 15:04:05 -0700 2006", // java.util.Date.toString
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 3:04:05 PM -0700", // DateFormat.MEDIUM, en_US
+	"Jan 2 2006 3:04:05 PM",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"02.01.2006 15:04:05 -0700",
+	"02.01.2006 15:04:05",
+	"02/01/2006 15:04:05 -0700",
+	"02/01/2006 15:04:05",
+}
+
+// Zone abbreviations Java prints; Go would accept unknown ones with a zero
+// offset, so they are resolved here. Abbreviations Java uses for more than one
+// offset are left out on purpose and fail to parse instead of being guessed:
+// IST (India, Ireland, Israel), CST/CDT (US Central, China, Cuba) and AST/ADT
+// (Atlantic, Arabia). BST is British Summer Time; Java prints BDT for
+// Bangladesh.
+var pageTimeZones = map[string]string{
+	"gmt": "+0000", "utc": "+0000", "ut": "+0000", "z": "+0000",
+	"wet": "+0000", "west": "+0100", "bst": "+0100",
+	"cet": "+0100", "cest": "+0200", "met": "+0100", "mest": "+0200", "mez": "+0100", "mesz": "+0200",
+	"eet": "+0200", "eest": "+0300", "msk": "+0300",
+	"sgt": "+0800", "hkt": "+0800", "jst": "+0900", "kst": "+0900",
+	"awst": "+0800", "acst": "+0930", "aest": "+1000", "aedt": "+1100", "nzst": "+1200", "nzdt": "+1300",
+	"est": "-0500", "edt": "-0400",
+	"mst": "-0700", "mdt": "-0600", "pst": "-0800", "pdt": "-0700", "akst": "-0900", "akdt": "-0800", "hst": "-1000",
+}
+
+var pageTimeMonths = map[string]string{}
+
+var pageTimeWeekdays = map[string]bool{}
+
+func init() {
+	months := [][]string{
+		{"jan", "january", "januar", "janvier", "enero", "ene", "gennaio", "gen", "januari", "janeiro"},
+		{"feb", "february", "februar", "février", "fév", "févr", "febrero", "febbraio", "februari", "fevereiro", "fev"},
+		{"mar", "march", "märz", "mär", "mars", "marzo", "maart", "mrt", "março"},
+		{"apr", "april", "avril", "avr", "abril", "abr", "aprile"},
+		{"may", "mai", "mayo", "maggio", "mag", "mei", "maio"},
+		{"jun", "june", "juni", "juin", "junio", "giugno", "giu", "junho"},
+		{"jul", "july", "juli", "juillet", "juil", "julio", "luglio", "lug", "julho"},
+		{"aug", "august", "août", "agosto", "ago", "augustus"},
+		{"sep", "sept", "september", "septembre", "septiembre", "settembre", "set", "setembro"},
+		{"oct", "october", "oktober", "okt", "octobre", "octubre", "ottobre", "ott", "outubro", "out"},
+		{"nov", "november", "novembre", "noviembre", "novembro"},
+		{"dec", "december", "dezember", "dez", "décembre", "déc", "diciembre", "dic", "dicembre", "dezembro"},
+	}
+	for i, names := range months {
+		en := time.Month(i + 1).String()[:3]
+		for _, n := range names {
+			pageTimeMonths[n] = en
+		}
+	}
+	for _, d := range []string{
+		"mon", "tue", "wed", "thu", "fri", "sat", "sun",
+		"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+		"mo", "di", "mi", "do", "fr", "sa", "so", // de
+		"lun", "mar", "mer", "jeu", "ven", "sam", "dim", // fr
+		"mié", "jue", "vie", "sáb", "dom", "gio", // es, it
+		"ma", "wo", "vr", "za", "zo", // nl
+		"seg", "ter", "qua", "qui", "sex", // pt
+		"montag", "dienstag", "mittwoch", "donnerstag", "freitag", "samstag", "sonntag",
+		"lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi", "dimanche",
+		"lunes", "martes", "miércoles", "jueves", "viernes", "sábado", "domingo",
+		"lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato", "domenica",
+		"maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag", "zondag",
+		"segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira",
+	} {
+		pageTimeWeekdays[d] = true
+	}
+}
+
+var zoneOffsetRe = regexp.MustCompile(`^(?:gmt|utc)?([+-])([0-9]{1,2})(?::?([0-9]{2}))?$`)
+
+// parsePageTime parses a timestamp from the home page. A timestamp without a
+// zone is taken as UTC, which is what GWC prints by default.
+func parsePageTime(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), nil
+	}
+
+	var fields []string
+	words := strings.FieldsFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+	for i, w := range words {
+		lw := strings.ToLower(strings.TrimSuffix(w, "."))
+		switch {
+		case zoneOffsetRe.MatchString(lw):
+			m := zoneOffsetRe.FindStringSubmatch(lw)
+			hours, mins := m[2], m[3]
+			if len(hours) == 1 {
+				hours = "0" + hours
+			}
+			if mins == "" {
+				mins = "00"
+			}
+			fields = append(fields, m[1]+hours+mins)
+		case strings.ContainsAny(lw, ":0123456789"):
+			if d := strings.TrimSuffix(w, "."); d != w && strings.Trim(d, "0123456789") == "" {
+				w = d // German ordinal day, "6."
+			}
+			fields = append(fields, w)
+		case pageTimeWeekdays[lw] && (i == 0 || pageTimeMonths[lw] == ""):
+			// Weekdays are redundant; "mar" is Tuesday (fr) only in front.
+		case pageTimeMonths[lw] != "":
+			fields = append(fields, pageTimeMonths[lw])
+		case pageTimeZones[lw] != "":
+			fields = append(fields, pageTimeZones[lw])
+		case lw == "am" || lw == "pm":
+			fields = append(fields, strings.ToUpper(lw))
+		default:
+			return 0, fmt.Errorf("unknown word %q in %q", w, s)
+		}
+	}
+	norm := strings.Join(fields, " ")
+	for _, layout := range pageTimeLayouts {
+		if t, err := time.Parse(layout, norm); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("no known layout matches %q", s)
+}
+
+var (
+	durationPartRe = regexp.MustCompile(`([0-9]+(?:[.,][0-9]+)?)\s*([^\s0-9.,]+)`)
+	durationSepRe  = regexp.MustCompile(`^(?:\s|,|and)*$`)
+)
+
+var durationUnits = map[string]int64{
+	"s": 1, "sec": 1, "secs": 1, "second": 1, "seconds": 1,
+	"m": 60, "min": 60, "mins": 60, "minute": 60, "minutes": 60,
+	"h": 3600, "hr": 3600, "hrs": 3600, "hour": 3600, "hours": 3600,
+	"d": 86400, "day": 86400, "days": 86400,
+	"w": 604800, "wk": 604800, "wks": 604800, "week": 604800, "weeks": 604800,
+	"month": 2592000, "months": 2592000,
+	"y": 31536000, "yr": 31536000, "yrs": 31536000, "year": 31536000, "years": 31536000,
+}
+
+// parsePageDuration parses single ("12 days", "3.5 hours") and compound ("2
+// days 3 hours 5 minutes", "1d 4h") durations. The second value is the
+// smallest unit used, which bounds the precision of the result.
+func parsePageDuration(s string) (secs, resolution int64, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	parts := durationPartRe.FindAllStringSubmatchIndex(s, -1)
+	if len(parts) == 0 {
+		return 0, 0, fmt.Errorf("no duration in %q", s)
+	}
+	var total float64
+	prev := 0
+	for _, p := range parts {
+		if !durationSepRe.MatchString(s[prev:p[0]]) {
+			return 0, 0, fmt.Errorf("unexpected %q in %q", s[prev:p[0]], s)
+		}
+		prev = p[1]
+		unit, ok := durationUnits[s[p[4]:p[5]]]
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown unit %q in %q", s[p[4]:p[5]], s)
+		}
+		total += toFloat(strings.ReplaceAll(s[p[2]:p[3]], ",", ".")) * float64(unit)
+		if resolution == 0 || unit < resolution {
+			resolution = unit
+		}
+	}
+	if !durationSepRe.MatchString(s[prev:]) {
+		return 0, 0, fmt.Errorf("unexpected %q in %q", s[prev:], s)
+	}
+	return int64(total), resolution, nil
+}
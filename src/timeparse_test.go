@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePageTime(t *testing.T) {
+	utc := func(y int, mo time.Month, d, h, mi, s int) int64 {
+		return time.Date(y, mo, d, h, mi, s, 0, time.UTC).Unix()
+	}
+	want := utc(2026, time.October, 6, 8, 0, 0)
+
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		// Layouts.
+		{"2026-10-06T08:00:00Z", want},
+		{"2026-10-06T10:00:00+02:00", want},
+		{"Tue, 06 Oct 2026 08:00:00 GMT", want},
+		{"Tue, 6 Oct 2026 08:00:00 GMT", want},
+		{"6 Oct 2026 08:00:00", want},
+		{"Tue Oct 06 08:00:00 UTC 2026", want},
+		{"Tue Oct 6 04:00:00 EDT 2026", want},
+		{"Oct 6, 2026 8:00:00 AM", want},
+		{"Oct 6, 2026 10:00:00 AM CEST", want},
+		{"Oct 6, 2026 8:00:00 PM", utc(2026, time.October, 6, 20, 0, 0)},
+		{"2026-10-06 08:00:00", want},
+		{"2026-10-06 10:00:00 +0200", want},
+		{"06.10.2026 08:00:00", want},
+		{"06.10.2026 10:00:00 MESZ", want},
+		{"06/10/2026 08:00:00", want},
+		{"06/10/2026 09:00:00 +01:00", want},
+
+		// Offsets.
+		{"6 Oct 2026 10:00:00 GMT+02:00", want},
+		{"6 Oct 2026 10:00:00 GMT+2", want},
+		{"6 Oct 2026 05:30:00 UTC-02:30", want},
+		{"Tue Oct 06 17:00:00 JST 2026", want},
+		{"Tue Oct 06 01:00:00 PDT 2026", want},
+
+		// Locales.
+		{"Di, 6 Okt 2026 10:00:00 MESZ", want},
+		{"Dienstag, 6. Oktober 2026 08:00:00", want},
+		{"mar. 6 oct. 2026 08:00:00", want},
+		{"mardi 6 octobre 2026 10:00:00 CEST", want},
+		{"6 mars 2026 08:00:00", utc(2026, time.March, 6, 8, 0, 0)},
+		{"mar 6 mars 2026 08:00:00", utc(2026, time.March, 6, 8, 0, 0)},
+		{"6 févr. 2026 08:00:00", utc(2026, time.February, 6, 8, 0, 0)},
+		{"6 de octubre de 2026 08:00:00", 0}, // "de" is not a known word
+		{"mié 6 ene 2027 08:00:00", utc(2027, time.January, 6, 8, 0, 0)},
+		{"6 dic 2026 08:00:00", utc(2026, time.December, 6, 8, 0, 0)},
+		{"gio 6 ago 2026 08:00:00", utc(2026, time.August, 6, 8, 0, 0)},
+		{"6 mrt 2026 08:00:00", utc(2026, time.March, 6, 8, 0, 0)},
+		{"di 6 mei 2026 08:00:00", utc(2026, time.May, 6, 8, 0, 0)},
+		{"ter 6 out 2026 08:00:00", want},
+		{"6 março 2026 08:00:00", utc(2026, time.March, 6, 8, 0, 0)},
+	}
+	for _, tt := range tests {
+		got, err := parsePageTime(tt.in)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parsePageTime(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePageTime(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePageTime(%q) = %s, want %s", tt.in, time.Unix(got, 0).UTC(), time.Unix(tt.want, 0).UTC())
+		}
+	}
+}
+
+func TestParsePageTimeAmbiguousZones(t *testing.T) {
+	for _, zone := range []string{"IST", "CST", "CDT", "AST", "ADT", "XYZ"} {
+		in := "Tue Oct 06 08:00:00 " + zone + " 2026"
+		if got, err := parsePageTime(in); err == nil {
+			t.Errorf("parsePageTime(%q) = %s, want an error", in, time.Unix(got, 0).UTC())
+		}
+	}
+}
+
+func TestParsePageTimeErrors(t *testing.T) {
+	for _, in := range []string{"", "never", "Oct 2026", "32 Oct 2026 08:00:00", "6 Foo 2026 08:00:00"} {
+		if got, err := parsePageTime(in); err == nil {
+			t.Errorf("parsePageTime(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParsePageDuration(t *testing.T) {
+	tests := []struct {
+		in         string
+		secs, res  int64
+		shouldFail bool
+	}{
+		{in: "42 seconds", secs: 42, res: 1},
+		{in: "1 second", secs: 1, res: 1},
+		{in: "30s", secs: 30, res: 1},
+		{in: "5 minutes", secs: 300, res: 60},
+		{in: "5 min", secs: 300, res: 60},
+		{in: "3.5 hours", secs: 12600, res: 3600},
+		{in: "3,5 hours", secs: 12600, res: 3600},
+		{in: "2 hrs", secs: 7200, res: 3600},
+		{in: "12 days", secs: 12 * 86400, res: 86400},
+		{in: "1d", secs: 86400, res: 86400},
+		{in: "2 weeks", secs: 2 * 604800, res: 604800},
+		{in: "1 month", secs: 2592000, res: 2592000},
+		{in: "1 year", secs: 31536000, res: 31536000},
+		{in: "2 yrs", secs: 2 * 31536000, res: 31536000},
+		{in: "2 days 3 hours 5 minutes", secs: 2*86400 + 3*3600 + 300, res: 60},
+		{in: "2 days, 3 hours and 5 minutes", secs: 2*86400 + 3*3600 + 300, res: 60},
+		{in: "1d 4h", secs: 86400 + 4*3600, res: 3600},
+		{in: "  7 Days  ", secs: 7 * 86400, res: 86400},
+		{in: "", shouldFail: true},
+		{in: "forever", shouldFail: true},
+		{in: "5 fortnights", shouldFail: true},
+		{in: "about 5 minutes", shouldFail: true},
+		{in: "5 minutes ago", shouldFail: true},
+	}
+	for _, tt := range tests {
+		secs, res, err := parsePageDuration(tt.in)
+		if tt.shouldFail {
+			if err == nil {
+				t.Errorf("parsePageDuration(%q) = %d, want an error", tt.in, secs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePageDuration(%q): %v", tt.in, err)
+			continue
+		}
+		if secs != tt.secs || res != tt.res {
+			t.Errorf("parsePageDuration(%q) = %d, %d; want %d, %d", tt.in, secs, res, tt.secs, tt.res)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tomcatStatus mirrors the relevant parts of /manager/status?XML=true.
+type tomcatStatus struct {
+	JVM struct {
+		Memory struct {
+			Free  float64 `xml:"free,attr"`
+			Total float64 `xml:"total,attr"`
+			Max   float64 `xml:"max,attr"`
+		} `xml:"memory"`
+	} `xml:"jvm"`
+	Connectors []struct {
+		Name       string `xml:"name,attr"`
+		ThreadInfo struct {
+			MaxThreads         float64 `xml:"maxThreads,attr"`
+			CurrentThreadCount float64 `xml:"currentThreadCount,attr"`
+			CurrentThreadsBusy float64 `xml:"currentThreadsBusy,attr"`
+		} `xml:"threadInfo"`
+		RequestInfo struct {
+			MaxTime        float64 `xml:"maxTime,attr"`
+			ProcessingTime float64 `xml:"processingTime,attr"`
+			RequestCount   float64 `xml:"requestCount,attr"`
+			ErrorCount     float64 `xml:"errorCount,attr"`
+			BytesReceived  float64 `xml:"bytesReceived,attr"`
+			BytesSent      float64 `xml:"bytesSent,attr"`
+		} `xml:"requestInfo"`
+	} `xml:"connector"`
+}
+
+// tomcatCollector scrapes the Tomcat manager that hosts GeoWebCache. Thread
+// pool usage per connector is the usual early warning before GWC stops
+// answering. Active sessions come from /manager/text/list, which needs the
+// manager-script role; without it only the status page is exported.
+type tomcatCollector struct {
+	managerURL string
+	auth       basicAuth
+	timeout    time.Duration
+
+	up                               *prometheus.Desc
+	connector_threads_max            *prometheus.Desc // label: connector
+	connector_threads_current        *prometheus.Desc // label: connector
+	connector_threads_busy           *prometheus.Desc // label: connector
+	connector_requests_total         *prometheus.Desc // label: connector
+	connector_errors_total           *prometheus.Desc // label: connector
+	connector_processing_seconds     *prometheus.Desc // label: connector
+	connector_max_processing_seconds *prometheus.Desc // label: connector
+	connector_bytes_received_total   *prometheus.Desc // label: connector
+	connector_bytes_sent_total       *prometheus.Desc // label: connector
+	jvm_memory_free_bytes            *prometheus.Desc
+	jvm_memory_total_bytes           *prometheus.Desc
+	jvm_memory_max_bytes             *prometheus.Desc
+	webapp_sessions_active           *prometheus.Desc // label: webapp
+	webapp_running                   *prometheus.Desc // label: webapp
+}
+
+func newTomcatCollector(managerURL string, auth basicAuth, timeout time.Duration) *tomcatCollector {
+	const ns = "gwc_tomcat"
+	return &tomcatCollector{
+		managerURL: strings.TrimRight(managerURL, "/"),
+		auth:       auth,
+		timeout:    timeout,
+
+		up:                               prometheus.NewDesc(ns+"_up", "Was the last scrape of the Tomcat manager status successful.", nil, nil),
+		connector_threads_max:            prometheus.NewDesc(ns+"_connector_threads_max", "Maximum threads of the connector thread pool.", []string{"connector"}, nil),
+		connector_threads_current:        prometheus.NewDesc(ns+"_connector_threads_current", "Current threads in the connector thread pool.", []string{"connector"}, nil),
+		connector_threads_busy:           prometheus.NewDesc(ns+"_connector_threads_busy", "Busy threads in the connector thread pool.", []string{"connector"}, nil),
+		connector_requests_total:         prometheus.NewDesc(ns+"_connector_requests_total", "Requests processed by the connector.", []string{"connector"}, nil),
+		connector_errors_total:           prometheus.NewDesc(ns+"_connector_errors_total", "Requests of the connector that ended in an error.", []string{"connector"}, nil),
+		connector_processing_seconds:     prometheus.NewDesc(ns+"_connector_processing_seconds_total", "Total request processing time of the connector.", []string{"connector"}, nil),
+		connector_max_processing_seconds: prometheus.NewDesc(ns+"_connector_max_processing_seconds", "Longest request processing time of the connector.", []string{"connector"}, nil),
+		connector_bytes_received_total:   prometheus.NewDesc(ns+"_connector_bytes_received_total", "Bytes received by the connector.", []string{"connector"}, nil),
+		connector_bytes_sent_total:       prometheus.NewDesc(ns+"_connector_bytes_sent_total", "Bytes sent by the connector.", []string{"connector"}, nil),
+		jvm_memory_free_bytes:            prometheus.NewDesc(ns+"_jvm_memory_free_bytes", "JVM free memory.", nil, nil),
+		jvm_memory_total_bytes:           prometheus.NewDesc(ns+"_jvm_memory_total_bytes", "JVM total memory.", nil, nil),
+		jvm_memory_max_bytes:             prometheus.NewDesc(ns+"_jvm_memory_max_bytes", "JVM maximum memory.", nil, nil),
+		webapp_sessions_active:           prometheus.NewDesc(ns+"_webapp_sessions_active", "Active sessions of the web application.", []string{"webapp"}, nil),
+		webapp_running:                   prometheus.NewDesc(ns+"_webapp_running", "1 if the web application is running, else 0.", []string{"webapp"}, nil),
+	}
+}
+
+func (c *tomcatCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.connector_threads_max
+	ch <- c.connector_threads_current
+	ch <- c.connector_threads_busy
+	ch <- c.connector_requests_total
+	ch <- c.connector_errors_total
+	ch <- c.connector_processing_seconds
+	ch <- c.connector_max_processing_seconds
+	ch <- c.connector_bytes_received_total
+	ch <- c.connector_bytes_sent_total
+	ch <- c.jvm_memory_free_bytes
+	ch <- c.jvm_memory_total_bytes
+	ch <- c.jvm_memory_max_bytes
+	ch <- c.webapp_sessions_active
+	ch <- c.webapp_running
+}
+
+func (c *tomcatCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	statusURL := c.managerURL + "/status?XML=true"
+	body, err := fetchURL(ctx, statusURL, c.auth)
+	if err != nil {
+		log.Printf("tomcat scrape: status failed target=%q err=%v", statusURL, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	var st tomcatStatus
+	if err := xml.Unmarshal(body, &st); err != nil {
+		log.Printf("tomcat scrape: cannot parse status target=%q err=%v", statusURL, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	ch <- prometheus.MustNewConstMetric(c.jvm_memory_free_bytes, prometheus.GaugeValue, st.JVM.Memory.Free)
+	ch <- prometheus.MustNewConstMetric(c.jvm_memory_total_bytes, prometheus.GaugeValue, st.JVM.Memory.Total)
+	ch <- prometheus.MustNewConstMetric(c.jvm_memory_max_bytes, prometheus.GaugeValue, st.JVM.Memory.Max)
+
+	for _, conn := range st.Connectors {
+		name := strings.Trim(conn.Name, `"`)
+		ti, ri := conn.ThreadInfo, conn.RequestInfo
+		ch <- prometheus.MustNewConstMetric(c.connector_threads_max, prometheus.GaugeValue, ti.MaxThreads, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_threads_current, prometheus.GaugeValue, ti.CurrentThreadCount, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_threads_busy, prometheus.GaugeValue, ti.CurrentThreadsBusy, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_requests_total, prometheus.CounterValue, ri.RequestCount, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_errors_total, prometheus.CounterValue, ri.ErrorCount, name)
+		// Tomcat reports processing times in milliseconds.
+		ch <- prometheus.MustNewConstMetric(c.connector_processing_seconds, prometheus.CounterValue, ri.ProcessingTime/1000, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_max_processing_seconds, prometheus.GaugeValue, ri.MaxTime/1000, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_bytes_received_total, prometheus.CounterValue, ri.BytesReceived, name)
+		ch <- prometheus.MustNewConstMetric(c.connector_bytes_sent_total, prometheus.CounterValue, ri.BytesSent, name)
+	}
+
+	listURL := c.managerURL + "/text/list"
+	list, err := fetchURL(ctx, listURL, c.auth)
+	if err != nil {
+		log.Printf("tomcat scrape: webapp list failed target=%q err=%v", listURL, err)
+		return
+	}
+	for _, app := range parseTomcatAppList(string(list)) {
+		running := 0.0
+		if app.state == "running" {
+			running = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.webapp_running, prometheus.GaugeValue, running, app.path)
+		ch <- prometheus.MustNewConstMetric(c.webapp_sessions_active, prometheus.GaugeValue, app.sessions, app.path)
+	}
+}
+
+type tomcatApp struct {
+	path     string
+	state    string
+	sessions float64
+}
+
+// parseTomcatAppList parses the manager text/list output:
+//
+//	OK - Listed applications for virtual host [localhost]
+//	/geowebcache:running:3:geowebcache
+func parseTomcatAppList(text string) []tomcatApp {
+	var apps []tomcatApp
+	for _, line := range strings.Split(text, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), ":")
+		if len(parts) < 3 || !strings.HasPrefix(parts[0], "/") {
+			continue
+		}
+		n, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			continue
+		}
+		apps = append(apps, tomcatApp{path: parts[0], state: parts[1], sessions: n})
+	}
+	return apps
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wmtsCapabilities mirrors the parts of the WMTS GetCapabilities document
+// that clients depend on. Namespaces are ignored.
+type wmtsCapabilities struct {
+	XMLName  xml.Name
+	Contents struct {
+		Layers []struct {
+			Identifier string   `xml:"Identifier"`
+			Formats    []string `xml:"Format"`
+			Links      []struct {
+				TileMatrixSet string `xml:"TileMatrixSet"`
+			} `xml:"TileMatrixSetLink"`
+		} `xml:"Layer"`
+		TileMatrixSets []struct {
+			Identifier   string     `xml:"Identifier"`
+			TileMatrices []struct{} `xml:"TileMatrix"`
+		} `xml:"TileMatrixSet"`
+	} `xml:"Contents"`
+}
+
+// restLayers mirrors GWC's /rest/layers listing.
+type restLayers struct {
+	Layers []struct {
+		Name string `xml:"name"`
+	} `xml:"layer"`
+}
+
+// WMTS capabilities checks, in the order they are reported.
+var wmtsChecks = []string{"xml", "layers", "tile_matrix_sets", "layer_formats", "layer_tile_matrix_sets", "tile_matrix_set_refs", "duplicate_identifiers", "rest_layers"}
+
+// wmtsCollector fetches the WMTS capabilities document on every scrape and
+// validates it, so a configuration mistake that leaves clients with a broken
+// or empty document shows up before users report it. With REST credentials
+// the layers of /rest/layers are also checked for presence in the document.
+type wmtsCollector struct {
+	capabilitiesURL string
+	restURL         string // empty skips the /rest/layers check
+	restAuth        basicAuth
+	timeout         time.Duration
+
+	up                *prometheus.Desc
+	duration          *prometheus.Desc
+	size_bytes        *prometheus.Desc
+	valid             *prometheus.Desc
+	check             *prometheus.Desc // label: check
+	layers            *prometheus.Desc
+	tile_matrix_sets  *prometheus.Desc
+	layer_format_info *prometheus.Desc // labels: layer, format
+	layer_missing     *prometheus.Desc // label: layer
+}
+
+func newWmtsCollector(targetURL string, restAuth basicAuth, timeout time.Duration) *wmtsCollector {
+	const ns = "gwc_wmts"
+	c := &wmtsCollector{
+		capabilitiesURL: gwcServiceURL(targetURL, "/service/wmts?REQUEST=GetCapabilities"),
+		restAuth:        restAuth,
+		timeout:         timeout,
+
+		up:                prometheus.NewDesc(ns+"_capabilities_up", "Was the last WMTS GetCapabilities request successful.", nil, nil),
+		duration:          prometheus.NewDesc(ns+"_capabilities_duration_seconds", "Time taken by the last WMTS GetCapabilities request.", nil, nil),
+		size_bytes:        prometheus.NewDesc(ns+"_capabilities_size_bytes", "Size of the WMTS capabilities document.", nil, nil),
+		valid:             prometheus.NewDesc(ns+"_capabilities_valid", "1 if the WMTS capabilities document passed all checks, else 0.", nil, nil),
+		check:             prometheus.NewDesc(ns+"_capabilities_check", "Result of a single WMTS capabilities check (1 passed, 0 failed).", []string{"check"}, nil),
+		layers:            prometheus.NewDesc(ns+"_layers", "Layers in the WMTS capabilities document.", nil, nil),
+		tile_matrix_sets:  prometheus.NewDesc(ns+"_tile_matrix_sets", "TileMatrixSets in the WMTS capabilities document.", nil, nil),
+		layer_format_info: prometheus.NewDesc(ns+"_layer_format_info", "Formats advertised per layer in the WMTS capabilities document.", []string{"layer", "format"}, nil),
+		layer_missing:     prometheus.NewDesc(ns+"_layer_missing", "Layers listed by /rest/layers but missing from the WMTS capabilities document.", []string{"layer"}, nil),
+	}
+	if restAuth.username != "" {
+		c.restURL = gwcServiceURL(targetURL, "/rest/layers")
+	}
+	return c
+}
+
+func (c *wmtsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.duration
+	ch <- c.size_bytes
+	ch <- c.valid
+	ch <- c.check
+	ch <- c.layers
+	ch <- c.tile_matrix_sets
+	ch <- c.layer_format_info
+	ch <- c.layer_missing
+}
+
+func (c *wmtsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	body, err := fetchURL(ctx, c.capabilitiesURL, basicAuth{})
+	ch <- prometheus.MustNewConstMetric(c.duration, prometheus.GaugeValue, time.Since(start).Seconds())
+	if err != nil {
+		log.Printf("wmts scrape: capabilities failed target=%q err=%v", c.capabilitiesURL, err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.size_bytes, prometheus.GaugeValue, float64(len(body)))
+
+	var restNames []string
+	if c.restURL != "" {
+		names, err := fetchRestLayers(ctx, c.restURL, c.restAuth)
+		if err != nil {
+			log.Printf("wmts scrape: rest layers failed target=%q err=%v", c.restURL, err)
+		} else {
+			restNames = names
+		}
+	}
+
+	caps, failures, missing := validateWmtsCapabilities(body, restNames)
+	for _, f := range failures {
+		log.Printf("wmts scrape: capabilities check failed target=%q %s", c.capabilitiesURL, f)
+	}
+	failed := map[string]bool{}
+	for _, f := range failures {
+		failed[f.check] = true
+	}
+	valid := 1.0
+	for _, name := range wmtsChecks {
+		if name == "rest_layers" && restNames == nil {
+			continue
+		}
+		if name != "xml" && caps == nil {
+			continue // nothing to check without a parsed document
+		}
+		v := 1.0
+		if failed[name] {
+			v, valid = 0, 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.check, prometheus.GaugeValue, v, name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.valid, prometheus.GaugeValue, valid)
+	for _, layer := range missing {
+		ch <- prometheus.MustNewConstMetric(c.layer_missing, prometheus.GaugeValue, 1, layer)
+	}
+	if caps == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.layers, prometheus.GaugeValue, float64(len(caps.Contents.Layers)))
+	ch <- prometheus.MustNewConstMetric(c.tile_matrix_sets, prometheus.GaugeValue, float64(len(caps.Contents.TileMatrixSets)))
+	// Repeated layer identifiers are reported by the duplicate_identifiers
+	// check; their formats are merged so every series is sent once.
+	seen := seriesSet{}
+	for _, l := range caps.Contents.Layers {
+		for _, f := range l.Formats {
+			f = strings.TrimSpace(f)
+			if f == "" || !seen.add(l.Identifier, f) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.layer_format_info, prometheus.GaugeValue, 1, l.Identifier, f)
+		}
+	}
+}
+
+type wmtsCheckFailure struct {
+	check  string
+	detail string
+}
+
+func (f wmtsCheckFailure) String() string {
+	return fmt.Sprintf("check=%s detail=%q", f.check, f.detail)
+}
+
+// validateWmtsCapabilities parses a capabilities document and runs the checks
+// in wmtsChecks. restNames, when not nil, are the layers GWC knows about; the
+// ones missing from the document are returned sorted.
+func validateWmtsCapabilities(body []byte, restNames []string) (*wmtsCapabilities, []wmtsCheckFailure, []string) {
+	var caps wmtsCapabilities
+	if err := xml.Unmarshal(body, &caps); err != nil {
+		return nil, []wmtsCheckFailure{{"xml", err.Error()}}, nil
+	}
+	if caps.XMLName.Local != "Capabilities" {
+		return nil, []wmtsCheckFailure{{"xml", "root element is " + caps.XMLName.Local}}, nil
+	}
+
+	var failures []wmtsCheckFailure
+	fail := func(check, format string, args ...any) {
+		failures = append(failures, wmtsCheckFailure{check, fmt.Sprintf(format, args...)})
+	}
+	if len(caps.Contents.Layers) == 0 {
+		fail("layers", "no layers")
+	}
+
+	sets := map[string]bool{}
+	for _, s := range caps.Contents.TileMatrixSets {
+		if sets[s.Identifier] {
+			fail("duplicate_identifiers", "tile matrix set %s is defined more than once", s.Identifier)
+		}
+		sets[s.Identifier] = true
+		if len(s.TileMatrices) == 0 {
+			fail("tile_matrix_sets", "tile matrix set %s has no tile matrices", s.Identifier)
+		}
+	}
+	if len(caps.Contents.TileMatrixSets) == 0 {
+		fail("tile_matrix_sets", "no tile matrix sets")
+	}
+
+	layers := map[string]bool{}
+	for _, l := range caps.Contents.Layers {
+		if layers[l.Identifier] {
+			fail("duplicate_identifiers", "layer %s is defined more than once", l.Identifier)
+		}
+		layers[l.Identifier] = true
+		if len(l.Formats) == 0 {
+			fail("layer_formats", "layer %s has no formats", l.Identifier)
+		}
+		if len(l.Links) == 0 {
+			fail("layer_tile_matrix_sets", "layer %s has no tile matrix set links", l.Identifier)
+		}
+		for _, link := range l.Links {
+			if !sets[link.TileMatrixSet] {
+				fail("tile_matrix_set_refs", "layer %s links undefined tile matrix set %s", l.Identifier, link.TileMatrixSet)
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range restNames {
+		if !layers[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	missing = slices.Compact(missing) // /rest/layers may repeat a name
+	if len(missing) > 0 {
+		fail("rest_layers", "%d layers missing: %s", len(missing), strings.Join(missing, ","))
+	}
+	return &caps, failures, missing
+}
+
+func fetchRestLayers(ctx context.Context, url string, auth basicAuth) ([]string, error) {
+	body, err := fetchURL(ctx, url, auth)
+	if err != nil {
+		return nil, err
+	}
+	var rl restLayers
+	if err := xml.Unmarshal(body, &rl); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(rl.Layers))
+	for _, l := range rl.Layers {
+		names = append(names, l.Name)
+	}
+	return names, nil
+}
+
+// gwcServiceURL builds a GWC endpoint URL from the home page URL given as
+// -target.url (".../geowebcache" or ".../geowebcache/home").
+func gwcServiceURL(targetURL, path string) string {
+	base := strings.TrimRight(targetURL, "/")
+	base = strings.TrimSuffix(base, "/home")
+	return base + path
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wmtsDoc builds a capabilities document from layer and tile matrix set
+// fragments.
+func wmtsDoc(layers, sets string) string {
+	return `<?xml version="1.0"?><Capabilities xmlns="http://www.opengis.net/wmts/1.0" xmlns:ows="http://www.opengis.net/ows/1.1"><Contents>` +
+		layers + sets + `</Contents></Capabilities>`
+}
+
+func wmtsLayer(id string, formats []string, sets ...string) string {
+	var b strings.Builder
+	b.WriteString("<Layer><ows:Identifier>" + id + "</ows:Identifier>")
+	for _, f := range formats {
+		b.WriteString("<Format>" + f + "</Format>")
+	}
+	for _, s := range sets {
+		b.WriteString("<TileMatrixSetLink><TileMatrixSet>" + s + "</TileMatrixSet></TileMatrixSetLink>")
+	}
+	b.WriteString("</Layer>")
+	return b.String()
+}
+
+func wmtsSet(id string, matrices int) string {
+	return "<TileMatrixSet><ows:Identifier>" + id + "</ows:Identifier>" + strings.Repeat("<TileMatrix/>", matrices) + "</TileMatrixSet>"
+}
+
+func TestValidateWmtsCapabilities(t *testing.T) {
+	png := []string{"image/png"}
+	tests := []struct {
+		name        string
+		doc         string
+		restNames   []string
+		wantFailed  []string // sorted check names
+		wantMissing []string
+	}{
+		{
+			name: "valid",
+			doc:  wmtsDoc(wmtsLayer("roads", png, "EPSG:3857")+wmtsLayer("water", png, "EPSG:3857"), wmtsSet("EPSG:3857", 3)),
+		},
+		{name: "not xml", doc: "<html>", wantFailed: []string{"xml"}},
+		{name: "wrong root", doc: "<ServiceExceptionReport/>", wantFailed: []string{"xml"}},
+		{name: "empty", doc: wmtsDoc("", ""), wantFailed: []string{"layers", "tile_matrix_sets"}},
+		{
+			name:       "set without matrices",
+			doc:        wmtsDoc(wmtsLayer("roads", png, "EPSG:3857"), wmtsSet("EPSG:3857", 0)),
+			wantFailed: []string{"tile_matrix_sets"},
+		},
+		{
+			name:       "layer without formats and links",
+			doc:        wmtsDoc(wmtsLayer("roads", nil), wmtsSet("EPSG:3857", 1)),
+			wantFailed: []string{"layer_formats", "layer_tile_matrix_sets"},
+		},
+		{
+			name:       "undefined set",
+			doc:        wmtsDoc(wmtsLayer("roads", png, "EPSG:4326"), wmtsSet("EPSG:3857", 1)),
+			wantFailed: []string{"tile_matrix_set_refs"},
+		},
+		{
+			name:       "duplicate layer",
+			doc:        wmtsDoc(wmtsLayer("roads", png, "EPSG:3857")+wmtsLayer("roads", []string{"image/jpeg"}, "EPSG:3857"), wmtsSet("EPSG:3857", 1)),
+			wantFailed: []string{"duplicate_identifiers"},
+		},
+		{
+			name:       "duplicate set",
+			doc:        wmtsDoc(wmtsLayer("roads", png, "EPSG:3857"), wmtsSet("EPSG:3857", 1)+wmtsSet("EPSG:3857", 2)),
+			wantFailed: []string{"duplicate_identifiers"},
+		},
+		{
+			name:        "rest layers",
+			doc:         wmtsDoc(wmtsLayer("roads", png, "EPSG:3857"), wmtsSet("EPSG:3857", 1)),
+			restNames:   []string{"water", "roads", "disabled", "water"},
+			wantFailed:  []string{"rest_layers"},
+			wantMissing: []string{"disabled", "water"},
+		},
+	}
+	for _, tt := range tests {
+		caps, failures, missing := validateWmtsCapabilities([]byte(tt.doc), tt.restNames)
+		var failed []string
+		for _, f := range failures {
+			if len(failed) == 0 || failed[len(failed)-1] != f.check {
+				failed = append(failed, f.check)
+			}
+		}
+		sort.Strings(failed)
+		if !reflect.DeepEqual(failed, tt.wantFailed) {
+			t.Errorf("%s: failed checks %v, want %v (%v)", tt.name, failed, tt.wantFailed, failures)
+		}
+		if !reflect.DeepEqual(missing, tt.wantMissing) {
+			t.Errorf("%s: missing %v, want %v", tt.name, missing, tt.wantMissing)
+		}
+		if (caps == nil) != (len(tt.wantFailed) == 1 && tt.wantFailed[0] == "xml") {
+			t.Errorf("%s: caps = %v", tt.name, caps)
+		}
+	}
+}
+
+// A repeated layer identifier or REST name must not produce duplicate
+// series, which would fail the whole scrape.
+func TestWmtsCollectorDuplicates(t *testing.T) {
+	doc := wmtsDoc(
+		wmtsLayer("roads", []string{"image/png", "image/png"}, "EPSG:3857")+wmtsLayer("roads", []string{"image/png", "image/jpeg"}, "EPSG:3857"),
+		wmtsSet("EPSG:3857", 1),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/geowebcache/service/wmts", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(doc))
+	})
+	mux.HandleFunc("/geowebcache/rest/layers", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<layers><layer><name>lost</name></layer><layer><name>lost</name></layer><layer><name>roads</name></layer></layers>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(newWmtsCollector(ts.URL+"/geowebcache", basicAuth{username: "admin"}, 5*time.Second))
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	checks := map[string]float64{}
+	for _, mf := range mfs {
+		got[mf.GetName()] = len(mf.Metric)
+		if mf.GetName() == "gwc_wmts_capabilities_check" {
+			for _, m := range mf.Metric {
+				checks[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	if got["gwc_wmts_layer_format_info"] != 2 || got["gwc_wmts_layer_missing"] != 1 {
+		t.Errorf("series counts %v", got)
+	}
+	if checks["duplicate_identifiers"] != 0 || checks["rest_layers"] != 0 || checks["layers"] != 1 {
+		t.Errorf("checks %v", checks)
+	}
+}
+
+func TestWmtsCollectorUnparsable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(newWmtsCollector(ts.URL+"/geowebcache", basicAuth{}, 5*time.Second))
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "gwc_wmts_capabilities_check":
+			if len(mf.Metric) != 1 || mf.Metric[0].Label[0].GetValue() != "xml" || mf.Metric[0].GetGauge().GetValue() != 0 {
+				t.Errorf("checks %v, want only xml=0", mf.Metric)
+			}
+		case "gwc_wmts_capabilities_valid":
+			if mf.Metric[0].GetGauge().GetValue() != 0 {
+				t.Error("unparsable document reported valid")
+			}
+		}
+	}
+}